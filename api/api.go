@@ -1,30 +1,36 @@
 package api
 
 import (
-	"strings"
-
+	"github.com/Grarak/GoYTFetcher/api/middleware"
 	"github.com/Grarak/GoYTFetcher/api/v1"
+	"github.com/Grarak/GoYTFetcher/api/v2"
 	"github.com/Grarak/GoYTFetcher/miniserver"
 )
 
-type apiHandle func(path string, client *miniserver.Client) miniserver.Response
+type apiRegister func(group *miniserver.RouteGroup)
+
+var v1Apis = map[string]apiRegister{
+	"info":    v1.RegisterInfoV1,
+	"users":   v1.RegisterUsersV1,
+	"youtube": v1.RegisterYoutubeV1,
+}
 
-var v1Apis = map[string]apiHandle{
-	"info":    v1.HandleInfoV1,
-	"users":   v1.HandleUsersV1,
-	"youtube": v1.HandleYoutubeV1,
+var v2Apis = map[string]apiRegister{
+	"users":     v2.RegisterUsersV2,
+	"playlists": v2.RegisterPlaylistsV2,
+	"history":   v2.RegisterHistoryV2,
+	"videos":    v2.RegisterVideosV2,
+	"search":    v2.RegisterSearchV2,
+	"cache":     v2.RegisterCacheV2,
+	"keys":      v2.RegisterKeysV2,
 }
 
-// GetResponse makes the request and gets the response from the server
-func GetResponse(version, api string, args []string, client *miniserver.Client) miniserver.Response {
-	var response apiHandle
-	switch version {
-	case "v1":
-		response = v1Apis[api]
-		break
+// RegisterRoutes adds the routes of all api versions to the router
+func RegisterRoutes(router *miniserver.Router) {
+	for api, register := range v1Apis {
+		register(router.Group("/api/v1/"+api, middleware.Authenticate))
 	}
-	if response != nil {
-		return response(strings.Join(args, "/"), client)
+	for api, register := range v2Apis {
+		register(router.Group("/api/v2/"+api, middleware.Authenticate, middleware.RequireUser))
 	}
-	return nil
 }
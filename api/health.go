@@ -0,0 +1,52 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Grarak/GoYTFetcher/health"
+	"github.com/Grarak/GoYTFetcher/miniserver"
+)
+
+// How long the readiness checks may take together
+const readyTimeout = 10 * time.Second
+
+// Probes spawn processes, so they don't run more often than this
+const readyCacheDuration = 5 * time.Second
+
+// RegisterHealth adds /healthz, which answers as long as the process runs,
+// and /readyz, which only succeeds if all checks do
+func RegisterHealth(router *miniserver.Router, checks map[string]health.Check) {
+	router.Handle(http.MethodGet, "/healthz", func(client *miniserver.Client) miniserver.Response {
+		response := client.CreateJsonResponse(health.Report{
+			Status: health.StatusOk,
+			Checks: map[string]health.CheckResult{},
+		})
+		response.SetHeader("Cache-Control", "no-store")
+		return response
+	})
+
+	var lock sync.Mutex
+	var report health.Report
+	var reportTime time.Time
+	router.Handle(http.MethodGet, "/readyz", func(client *miniserver.Client) miniserver.Response {
+		lock.Lock()
+		if time.Since(reportTime) > readyCacheDuration {
+			ctx, cancel := context.WithTimeout(context.Background(), readyTimeout)
+			report = health.Run(ctx, checks)
+			reportTime = time.Now()
+			cancel()
+		}
+		report := report
+		lock.Unlock()
+
+		response := client.CreateJsonResponse(report)
+		response.SetHeader("Cache-Control", "no-store")
+		if report.Status != health.StatusOk {
+			response.SetStatusCode(http.StatusServiceUnavailable)
+		}
+		return response
+	})
+}
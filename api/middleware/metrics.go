@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"bytes"
+	"strconv"
+	"time"
+
+	"github.com/Grarak/GoYTFetcher/metrics"
+	"github.com/Grarak/GoYTFetcher/miniserver"
+	"github.com/Grarak/GoYTFetcher/utils"
+)
+
+var (
+	requests = metrics.NewCounter("ytfetcher_http_requests_total",
+		"Handled requests by route, method and status", "route", "method", "status")
+	requestDuration = metrics.NewHistogram("ytfetcher_http_request_duration_seconds",
+		"Time until the response was written by route", metrics.DefaultBuckets, "route")
+	servedBytes = metrics.NewCounter("ytfetcher_audio_served_bytes_total",
+		"Audio bytes sent to clients from the local cache or proxied from youtube", "source")
+)
+
+// Song sources of ServedBytes
+const (
+	SourceLocal = "local"
+	SourceProxy = "proxy"
+)
+
+// ObserveRequest records every request, pass it to MiniServer.SetRequestObserver
+func ObserveRequest(client *miniserver.Client, status int, size int64, duration time.Duration) {
+	route := client.Pattern
+	if utils.StringIsEmpty(route) {
+		// Unmatched paths would blow up the number of series
+		route = "other"
+	}
+	requests.Inc(route, client.Method, strconv.Itoa(status))
+	requestDuration.Observe(duration.Seconds(), route)
+}
+
+// ServedBytes counts the audio bytes response sends
+func ServedBytes(response miniserver.Response, source string) miniserver.Response {
+	return miniserver.ObserveSize(response, func(size int64) {
+		servedBytes.Add(float64(size), source)
+	})
+}
+
+func Metrics(client *miniserver.Client) miniserver.Response {
+	buf := new(bytes.Buffer)
+	metrics.Write(buf)
+	response := client.ResponseBodyBytes(buf.Bytes())
+	response.SetContentType(metrics.ContentType)
+	response.SetHeader("Cache-Control", "no-store")
+	return response
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/Grarak/GoYTFetcher/database"
+	"github.com/Grarak/GoYTFetcher/miniserver"
+	"github.com/Grarak/GoYTFetcher/utils"
+)
+
+// Endpoint groups which share a rate limit budget
+const (
+	LimitAuth   = "auth"
+	LimitSearch = "search"
+	LimitFetch  = "fetch"
+	LimitGet    = "get"
+)
+
+var rateLimiters = make(map[string]*miniserver.RateLimiter)
+
+// SetRateLimit configures the budget of an endpoint group,
+// it has to be called before the server starts listening
+func SetRateLimit(group string, limit miniserver.RateLimit) {
+	rateLimiters[group] = miniserver.NewRateLimiter(limit)
+}
+
+// RateLimits returns the budgets of the endpoint groups which are limited
+func RateLimits() map[string]miniserver.RateLimit {
+	limits := make(map[string]miniserver.RateLimit)
+	for group, limiter := range rateLimiters {
+		if limiter.Limit().Enabled() {
+			limits[group] = limiter.Limit()
+		}
+	}
+	return limits
+}
+
+// RateLimit limits the requests to the endpoint group per ip address
+// and per user, requests of admins are never limited
+func RateLimit(group string) miniserver.Middleware {
+	return rateLimit(group, func(client *miniserver.Client) []string {
+		return nil
+	})
+}
+
+// RateLimitLogin additionally limits the attempts per username of the body,
+// so guessing a password from many addresses doesn't get further either
+func RateLimitLogin(group string) miniserver.Middleware {
+	return rateLimit(group, func(client *miniserver.Client) []string {
+		request, err := database.NewUser(client.Request)
+		if err != nil || utils.StringIsEmpty(request.Name) {
+			return nil
+		}
+		// Names are unique regardless of their case
+		return []string{"name:" + strings.ToLower(request.Name)}
+	})
+}
+
+func rateLimit(group string, extraKeys func(client *miniserver.Client) []string) miniserver.Middleware {
+	return func(next miniserver.Handler) miniserver.Handler {
+		return func(client *miniserver.Client) miniserver.Response {
+			limiter, ok := rateLimiters[group]
+			if !ok {
+				return next(client)
+			}
+
+			keys := []string{"ip:" + client.IPAddr}
+			if user, ok := RequestUser(client); ok {
+				if *user.Admin {
+					return next(client)
+				}
+				keys = append(keys, "user:"+user.Id)
+			}
+			keys = append(keys, extraKeys(client)...)
+
+			if allowed, retryAfter := limiter.Allow(keys...); !allowed {
+				return client.ResponseTooManyRequests(retryAfter)
+			}
+			return next(client)
+		}
+	}
+}
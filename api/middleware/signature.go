@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Grarak/GoYTFetcher/miniserver"
+	"github.com/Grarak/GoYTFetcher/utils"
+)
+
+// SignedUrlLifetime is how long urls of SignUrl can be opened
+const SignedUrlLifetime = 12 * time.Hour
+
+// signingKey only lives as long as the process, like the encrypted song ids
+var signingKey = utils.GenerateRandom(32)
+
+func urlSignature(path, id string, expires int64) string {
+	mac := hmac.New(sha256.New, signingKey)
+	mac.Write([]byte(path + "\n" + id + "\n" + strconv.FormatInt(expires, 10)))
+	return utils.ToURLBase64(mac.Sum(nil))
+}
+
+// SignUrl returns the queries which let players open path with id
+// without an apikey, they can't set headers and v1 hands out plain urls
+func SignUrl(path, id string) url.Values {
+	expires := time.Now().Add(SignedUrlLifetime).Unix()
+	query := url.Values{}
+	query.Set("id", id)
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("signature", urlSignature(path, id, expires))
+	return query
+}
+
+// hasValidSignature checks the queries SignUrl added to the url
+func hasValidSignature(client *miniserver.Client) bool {
+	signature := client.Queries.Get("signature")
+	expires, err := strconv.ParseInt(client.Queries.Get("expires"), 10, 64)
+	if utils.StringIsEmpty(signature) || err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	expected := urlSignature(client.Url, client.Queries.Get("id"), expires)
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
+
+// RequireUserOrSignature is like RequireUser, but also lets
+// requests to urls created by SignUrl through
+func RequireUserOrSignature(next miniserver.Handler) miniserver.Handler {
+	requireUser := RequireUser(next)
+	return func(client *miniserver.Client) miniserver.Response {
+		if _, ok := RequestUser(client); !ok && hasValidSignature(client) {
+			return next(client)
+		}
+		return requireUser(client)
+	}
+}
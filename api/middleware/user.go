@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/Grarak/GoYTFetcher/database"
+	"github.com/Grarak/GoYTFetcher/miniserver"
+	"github.com/Grarak/GoYTFetcher/utils"
+)
+
+// ApiKeyCookie is read if a request has no Authorization header
+const ApiKeyCookie = "ytfetcher_apikey"
+
+type userContextKey struct{}
+
+// Authenticate resolves the apikey of the request once and puts its
+// user on the request context. Requests without a known apikey
+// pass through, RequireUser and RequireAdmin reject them
+func Authenticate(next miniserver.Handler) miniserver.Handler {
+	return func(client *miniserver.Client) miniserver.Response {
+		if apiKey := requestApiKey(client); !utils.StringIsEmpty(apiKey) {
+			usersDB := database.GetDefaultDatabase().UsersDB
+			if user, err := usersDB.FindUserByApiKey(apiKey); err == nil {
+				client.UserName = user.Name
+				client.WithValue(userContextKey{}, user)
+			}
+		}
+		return next(client)
+	}
+}
+
+// ApiKeyQuery lets a route take the apikey as ?apikey= query parameter, for
+// EventSource and audio players which can't set headers. Only routes which opt in
+// accept it, apikeys in urls end up in logs and browser histories
+func ApiKeyQuery(next miniserver.Handler) miniserver.Handler {
+	return func(client *miniserver.Client) miniserver.Response {
+		apiKey := client.Queries.Get("apikey")
+		if _, ok := RequestUser(client); !ok && !utils.StringIsEmpty(apiKey) {
+			usersDB := database.GetDefaultDatabase().UsersDB
+			if user, err := usersDB.FindUserByApiKey(apiKey); err == nil {
+				client.UserName = user.Name
+				client.WithValue(userContextKey{}, user)
+			}
+		}
+		return next(client)
+	}
+}
+
+// RequestUser returns the user Authenticate resolved, if any
+func RequestUser(client *miniserver.Client) (database.User, bool) {
+	user, ok := client.Context().Value(userContextKey{}).(database.User)
+	return user, ok
+}
+
+// User returns the requester of routes behind RequireUser or RequireAdmin
+func User(client *miniserver.Client) database.User {
+	user, _ := RequestUser(client)
+	return user
+}
+
+// RequireUser only lets verified users through
+func RequireUser(next miniserver.Handler) miniserver.Handler {
+	return func(client *miniserver.Client) miniserver.Response {
+		if code := verifiedUser(client); code != utils.StatusNoError {
+			return rejectUser(client, code)
+		}
+		return next(client)
+	}
+}
+
+// RequireAdmin is like RequireUser, but only lets admins through
+func RequireAdmin(next miniserver.Handler) miniserver.Handler {
+	return func(client *miniserver.Client) miniserver.Response {
+		code := verifiedUser(client)
+		if code == utils.StatusNoError && !*User(client).Admin {
+			code = utils.StatusForbidden
+		}
+		if code != utils.StatusNoError {
+			return rejectUser(client, code)
+		}
+		return next(client)
+	}
+}
+
+// verifiedUser tells why the requester isn't allowed to continue
+func verifiedUser(client *miniserver.Client) int {
+	user, ok := RequestUser(client)
+	if !ok {
+		return utils.StatusUnauthorized
+	}
+	if !*user.Verified {
+		return utils.StatusNotVerified
+	}
+	return utils.StatusNoError
+}
+
+func rejectUser(client *miniserver.Client, code int) miniserver.Response {
+	response := client.CreateResponse(code)
+	if code == utils.StatusUnauthorized {
+		response.SetHeader("WWW-Authenticate", "Bearer realm=\"ytfetcher\"")
+	}
+	return response
+}
+
+// BearerToken returns the token of an "Authorization: Bearer" header
+func BearerToken(client *miniserver.Client) string {
+	authorization := client.Header.Get("Authorization")
+	if len(authorization) > 7 && strings.EqualFold(authorization[:7], "Bearer ") {
+		return strings.TrimSpace(authorization[7:])
+	}
+	return ""
+}
+
+// requestApiKey takes the apikey from the Authorization header or the cookie,
+// v1 requests carry it in the json body instead
+func requestApiKey(client *miniserver.Client) string {
+	if token := BearerToken(client); !utils.StringIsEmpty(token) {
+		return token
+	}
+	if cookie := client.Cookie(ApiKeyCookie); !utils.StringIsEmpty(cookie) {
+		return cookie
+	}
+	if client.IsContentJson() {
+		var request struct {
+			ApiKey string `json:"apikey"`
+		}
+		json.Unmarshal(client.Request, &request)
+		return request.ApiKey
+	}
+	return ""
+}
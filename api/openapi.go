@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/Grarak/GoYTFetcher/api/middleware"
+	"github.com/Grarak/GoYTFetcher/miniserver"
+	"github.com/Grarak/GoYTFetcher/openapi"
+	"github.com/Grarak/GoYTFetcher/utils"
+)
+
+// RegisterOpenApi publishes the OpenAPI document of all routes below /api/
+// on /api/openapi.json. It's generated on the first request, so routes added
+// afterwards are part of it too. viewer adds a page to browse it on /api/docs
+func RegisterOpenApi(router *miniserver.Router, viewer bool) {
+	var once sync.Once
+	var document *openapi.Document
+	router.Handle(http.MethodGet, "/api/openapi.json", func(client *miniserver.Client) miniserver.Response {
+		once.Do(func() {
+			document = newOpenApiDocument(router.Routes())
+		})
+		response := client.CreateJsonResponse(document)
+		response.EnableETag()
+		response.SetHeader("Cache-Control", "no-cache")
+		return response
+	}).Describe("This document")
+
+	if viewer {
+		router.Handle(http.MethodGet, "/api/docs", func(client *miniserver.Client) miniserver.Response {
+			response := client.ResponseBody(openApiViewer)
+			response.SetContentType(miniserver.ContentHtml)
+			return response
+		}).Describe("Browse this document").Produces(miniserver.ContentHtml)
+	}
+}
+
+func newOpenApiDocument(routes []miniserver.RouteInfo) *openapi.Document {
+	document := openapi.New("GoYTFetcher", "2")
+	document.Info.Description = "Fetches, caches and serves the audio of youtube videos. " +
+		"Errors carry a status code which keeps its meaning across versions. " +
+		"Server version " + utils.Version + " (" + utils.Commit + ")."
+	document.AddSecurityScheme("bearer", openapi.SecurityScheme{
+		Type:        "http",
+		Scheme:      "bearer",
+		Description: "An apikey returned by signup, login or POST /api/v2/keys",
+	})
+	document.AddSecurityScheme("cookie", openapi.SecurityScheme{
+		Type: "apiKey",
+		In:   "cookie",
+		Name: middleware.ApiKeyCookie,
+	})
+	status := document.SetErrorResponse(miniserver.StatusResponse{}, "Error with its status code")
+	status.Properties["statuscode"] = openapi.Codes(utils.StatusCodes(), utils.StatusMessage)
+	document.AddRoutes(routes, "/api/")
+	return document
+}
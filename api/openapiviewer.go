@@ -0,0 +1,148 @@
+package api
+
+// openApiViewer renders /api/openapi.json, it's self-contained so it works offline
+const openApiViewer = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>GoYTFetcher API</title>
+<style>
+body { font-family: sans-serif; margin: 0 auto; max-width: 960px; padding: 1em; color: #222; }
+h2 { border-bottom: 1px solid #ddd; padding-bottom: .2em; }
+details { border: 1px solid #ddd; border-radius: 4px; margin: .4em 0; }
+summary { cursor: pointer; padding: .5em; }
+.method { display: inline-block; width: 4.5em; font-weight: bold; text-transform: uppercase; }
+.get { color: #2a7ae2; } .post { color: #2e9e4f; } .put { color: #c78a00; } .delete { color: #d33; }
+.body { padding: 0 1em 1em; }
+pre { background: #f6f6f6; padding: .6em; overflow-x: auto; }
+.muted { color: #777; }
+</style>
+</head>
+<body>
+<h1 id="title">GoYTFetcher API</h1>
+<p id="description" class="muted"></p>
+<div id="operations">Loading <a href="openapi.json">openapi.json</a>...</div>
+<script>
+function resolve(document, schema) {
+	while (schema && schema.$ref) {
+		schema = document.components.schemas[schema.$ref.split("/").pop()];
+	}
+	return schema || {};
+}
+
+// example builds a json value which looks like the schema
+function example(document, schema, seen) {
+	var name = schema.$ref ? schema.$ref.split("/").pop() : null;
+	if (name) {
+		if (seen.indexOf(name) >= 0) {
+			return "<" + name + ">";
+		}
+		seen = seen.concat(name);
+	}
+	schema = resolve(document, schema);
+	switch (schema.type) {
+	case "object":
+		if (schema.additionalProperties) {
+			return {"<key>": example(document, schema.additionalProperties, seen)};
+		}
+		var object = {};
+		Object.keys(schema.properties || {}).forEach(function (key) {
+			object[key] = example(document, schema.properties[key], seen);
+		});
+		return object;
+	case "array":
+		return [example(document, schema.items || {}, seen)];
+	case "integer":
+	case "number":
+		return schema.enum ? schema.enum[0] : 0;
+	case "boolean":
+		return false;
+	case "string":
+		return schema.format ? "<" + schema.format + ">" : "";
+	}
+	return null;
+}
+
+function element(tag, text, className) {
+	var node = document.createElement(tag);
+	if (text) {
+		node.textContent = text;
+	}
+	if (className) {
+		node.className = className;
+	}
+	return node;
+}
+
+function content(spec, body, title, media) {
+	Object.keys(media || {}).forEach(function (type) {
+		body.appendChild(element("h4", title + " (" + type + ")"));
+		var schema = media[type].schema || {};
+		var value = schema.format === "binary" ? "<binary>" :
+			JSON.stringify(example(spec, schema, []), null, 2);
+		body.appendChild(element("pre", value));
+	});
+}
+
+fetch("openapi.json").then(function (response) {
+	return response.json();
+}).then(function (spec) {
+	document.getElementById("title").textContent = spec.info.title + " " + spec.info.version;
+	document.getElementById("description").textContent = spec.info.description || "";
+
+	var tags = {};
+	Object.keys(spec.paths).sort().forEach(function (path) {
+		Object.keys(spec.paths[path]).forEach(function (method) {
+			var operation = spec.paths[path][method];
+			var tag = (operation.tags || ["other"])[0];
+			(tags[tag] = tags[tag] || []).push({path: path, method: method, operation: operation});
+		});
+	});
+
+	var root = document.getElementById("operations");
+	root.textContent = "";
+	Object.keys(tags).sort().forEach(function (tag) {
+		root.appendChild(element("h2", tag));
+		tags[tag].forEach(function (entry) {
+			var operation = entry.operation;
+			var details = element("details");
+			var summary = element("summary");
+			summary.appendChild(element("span", entry.method, "method " + entry.method));
+			summary.appendChild(element("code", entry.path));
+			summary.appendChild(element("span", operation.summary ? " " + operation.summary : "", "muted"));
+			details.appendChild(summary);
+
+			var body = element("div", null, "body");
+			(operation.parameters || []).forEach(function (parameter) {
+				body.appendChild(element("div", parameter.in + " " + parameter.name +
+					(parameter.description ? ": " + parameter.description : "")));
+			});
+			if (operation.requestBody) {
+				content(spec, body, "Request", operation.requestBody.content);
+			}
+			Object.keys(operation.responses).sort().forEach(function (status) {
+				var response = operation.responses[status];
+				if (response.content) {
+					content(spec, body, "Response " + status, response.content);
+				} else {
+					body.appendChild(element("h4", "Response " + status + " " + response.description));
+				}
+			});
+			details.appendChild(body);
+			root.appendChild(details);
+		});
+	});
+
+	var errors = resolve(spec, {$ref: "#/components/schemas/StatusResponse"});
+	if (errors.properties) {
+		root.appendChild(element("h2", "Status codes"));
+		root.appendChild(element("pre", errors.properties.statuscode.description));
+	}
+}).catch(function (error) {
+	document.getElementById("operations").textContent = "Failed to load openapi.json: " + error;
+});
+</script>
+</body>
+</html>
+`
@@ -1,7 +1,80 @@
 package v1
 
-import "github.com/Grarak/GoYTFetcher/miniserver"
+import (
+	"sort"
 
-func HandleInfoV1(_ string, client *miniserver.Client) miniserver.Response {
-	return client.ResponseBody("Welcome to V1 API!")
+	"github.com/Grarak/GoYTFetcher/api/middleware"
+	"github.com/Grarak/GoYTFetcher/database"
+	"github.com/Grarak/GoYTFetcher/miniserver"
+	"github.com/Grarak/GoYTFetcher/utils"
+)
+
+// ApiVersions lists the versions served below /api/
+var ApiVersions = []string{"v1", "v2"}
+
+// ServerInfo lets clients adapt to the server before signing up,
+// MaxDuration is the longest video in seconds which is downloaded
+type ServerInfo struct {
+	Version       string                 `json:"version"`
+	Commit        string                 `json:"commit"`
+	ApiVersions   []string               `json:"apiversions"`
+	YoutubeApiKey bool                   `json:"youtubeapikey"`
+	Charts        bool                   `json:"charts"`
+	MaxDuration   int                    `json:"maxduration"`
+	Formats       []database.AudioFormat `json:"formats"`
+	Signup        string                 `json:"signup"`
+	Limits        ServerLimits           `json:"limits"`
+}
+
+// ServerLimits are the sizes requests may have
+type ServerLimits struct {
+	PageSize    int         `json:"pagesize"`
+	MaxPageSize int         `json:"maxpagesize"`
+	MaxBatch    int         `json:"maxbatch"`
+	RateLimits  []RateLimit `json:"ratelimits"`
+}
+
+// RateLimit is the budget of an endpoint group per ip and user
+type RateLimit struct {
+	Group    string  `json:"group"`
+	Requests int     `json:"requests"`
+	Seconds  float64 `json:"seconds"`
+}
+
+func infoGet(client *miniserver.Client) miniserver.Response {
+	databaseInstance := database.GetDefaultDatabase()
+	youtubeDB := databaseInstance.YoutubeDB
+
+	info := ServerInfo{
+		Version:       utils.Version,
+		Commit:        utils.Commit,
+		ApiVersions:   ApiVersions,
+		YoutubeApiKey: youtubeDB.HasApiKey(),
+		Charts:        youtubeDB.ChartsAvailable(),
+		MaxDuration:   int(database.MaxDownloadDuration.Seconds()),
+		Formats:       database.AudioFormats,
+		Signup:        databaseInstance.UsersDB.SignupPolicy(),
+		Limits: ServerLimits{
+			PageSize:    database.DefaultPageSize,
+			MaxPageSize: database.MaxPageSize,
+			MaxBatch:    database.MaxYoutubeInfos,
+			RateLimits:  make([]RateLimit, 0),
+		},
+	}
+	for group, limit := range middleware.RateLimits() {
+		info.Limits.RateLimits = append(info.Limits.RateLimits,
+			RateLimit{group, limit.Requests, limit.Per.Seconds()})
+	}
+	sort.Slice(info.Limits.RateLimits, func(i, j int) bool {
+		return info.Limits.RateLimits[i].Group < info.Limits.RateLimits[j].Group
+	})
+
+	response := client.CreateJsonResponse(info)
+	response.SetHeader("Cache-Control", "no-cache")
+	return response
+}
+
+func RegisterInfoV1(group *miniserver.RouteGroup) {
+	group.Get("", infoGet).Describe("Version and capabilities of the server").Returns(ServerInfo{})
+	group.Post("", infoGet).Describe("Version and capabilities of the server").Returns(ServerInfo{})
 }
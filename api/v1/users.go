@@ -1,10 +1,11 @@
 package v1
 
 import (
+	"database/sql"
 	"fmt"
-	"net/http"
 	"strconv"
 
+	"github.com/Grarak/GoYTFetcher/api/middleware"
 	"github.com/Grarak/GoYTFetcher/database"
 	"github.com/Grarak/GoYTFetcher/logger"
 	"github.com/Grarak/GoYTFetcher/miniserver"
@@ -20,6 +21,7 @@ func usersSignUp(client *miniserver.Client) miniserver.Response {
 	usersDB := database.GetDefaultDatabase().UsersDB
 	user, code := usersDB.AddUser(request)
 	if code == utils.StatusNoError {
+		client.UserName = user.Name
 		logger.I(client.IPAddr + ": " + "Created new user " + user.Name)
 		return client.CreateJsonResponse(user)
 	}
@@ -36,6 +38,14 @@ func usersLogin(client *miniserver.Client) miniserver.Response {
 	usersDB := database.GetDefaultDatabase().UsersDB
 	user, code := usersDB.GetUserWithPassword(request.Name, request.Password)
 	if code == utils.StatusNoError {
+		// Only hashes of the keys are stored, so every login gets a new one
+		apiKey, err := usersDB.CreateLoginApiKey(user.Id)
+		if err != nil {
+			logger.E(err)
+			return client.CreateResponse(utils.StatusInternalError)
+		}
+		user.ApiKey = apiKey.Key
+		client.UserName = user.Name
 		logger.I(client.IPAddr + ": " + user.Name + " logged in")
 		return client.CreateJsonResponse(user)
 	}
@@ -44,24 +54,23 @@ func usersLogin(client *miniserver.Client) miniserver.Response {
 }
 
 func usersList(client *miniserver.Client) miniserver.Response {
-	request, err := database.NewUser(client.Request)
-	if err != nil {
+	if _, err := database.NewUser(client.Request); err != nil {
 		return client.CreateResponse(utils.StatusInvalid)
 	}
 
-	usersDB := database.GetDefaultDatabase().UsersDB
-	if user, err := usersDB.FindUserByApiKey(request.ApiKey); err == nil && *user.Verified {
-		page, err := strconv.Atoi(client.Queries.Get("page"))
-		if err != nil {
-			page = 1
-		}
-		users, err := usersDB.ListUsers(page)
-		if err == nil {
-			return client.CreateJsonResponse(users)
-		}
+	page, err := strconv.Atoi(client.Queries.Get("page"))
+	if err != nil {
+		page = 1
 	}
-
-	return client.CreateResponse(utils.StatusInvalid)
+	if page < 1 {
+		page = 1
+	}
+	users, err := database.GetDefaultDatabase().UsersDB.ListUsers(database.UserFilter{},
+		database.PageRequest{Offset: 10 * (page - 1), Size: 10})
+	if err != nil {
+		return client.CreateResponse(databaseStatus(err))
+	}
+	return client.CreateJsonResponse(users.Items)
 }
 
 func usersSetVerification(client *miniserver.Client) miniserver.Response {
@@ -70,17 +79,12 @@ func usersSetVerification(client *miniserver.Client) miniserver.Response {
 		return client.CreateResponse(utils.StatusInvalid)
 	}
 
-	usersDB := database.GetDefaultDatabase().UsersDB
-	if requester, err := usersDB.FindUserByApiKey(request.ApiKey); err == nil && *requester.Admin {
-		logger.I(fmt.Sprintf("%s setting verification of %s to %v", requester.Name,
-			request.Name, *request.Verified))
-		err = usersDB.SetVerificationUser(request)
-		if err == nil {
-			return client.CreateResponse(utils.StatusNoError)
-		}
-	}
+	requester := middleware.User(client)
 
-	return client.CreateResponse(utils.StatusInvalid)
+	logger.I(fmt.Sprintf("%s setting verification of %s to %v", requester.Name,
+		request.Name, *request.Verified))
+	err = database.GetDefaultDatabase().UsersDB.SetVerificationUser(request)
+	return client.CreateResponse(databaseStatus(err))
 }
 
 func usersDelete(client *miniserver.Client) miniserver.Response {
@@ -89,15 +93,8 @@ func usersDelete(client *miniserver.Client) miniserver.Response {
 		return client.CreateResponse(utils.StatusInvalid)
 	}
 
-	usersDB := database.GetDefaultDatabase().UsersDB
-	if requester, err := usersDB.FindUserByApiKey(request.ApiKey); err == nil && *requester.Admin {
-		err = usersDB.DeleteUser(request)
-		if err != nil {
-			return client.CreateResponse(utils.StatusNoError)
-		}
-	}
-
-	return client.CreateResponse(utils.StatusInvalid)
+	err = database.GetDefaultDatabase().UsersDB.DeleteUser(request)
+	return client.CreateResponse(databaseStatus(err))
 }
 
 func usersDeleteAll(client *miniserver.Client) miniserver.Response {
@@ -106,15 +103,8 @@ func usersDeleteAll(client *miniserver.Client) miniserver.Response {
 		return client.CreateResponse(utils.StatusInvalid)
 	}
 
-	usersDB := database.GetDefaultDatabase().UsersDB
-	if requester, err := usersDB.FindUserByApiKey(request.ApiKey); err == nil && *requester.Admin {
-		err = usersDB.DeleteAllNonVerifiedUsers(request)
-		if err == nil {
-			return client.CreateResponse(utils.StatusNoError)
-		}
-	}
-
-	return client.CreateResponse(utils.StatusInvalid)
+	err = database.GetDefaultDatabase().UsersDB.DeleteAllNonVerifiedUsers(request)
+	return client.CreateResponse(databaseStatus(err))
 }
 
 func usersResetPassword(client *miniserver.Client) miniserver.Response {
@@ -123,15 +113,8 @@ func usersResetPassword(client *miniserver.Client) miniserver.Response {
 		return client.CreateResponse(utils.StatusInvalid)
 	}
 
-	usersDB := database.GetDefaultDatabase().UsersDB
-	if requester, err := usersDB.FindUserByApiKey(request.ApiKey); err == nil && *requester.Admin {
-		err = usersDB.ResetPasswordUser(request)
-		if err == nil {
-			return client.CreateResponse(utils.StatusNoError)
-		}
-	}
-
-	return client.CreateResponse(utils.StatusInvalid)
+	err = database.GetDefaultDatabase().UsersDB.ResetPasswordUser(request)
+	return client.CreateResponse(databaseStatus(err))
 }
 
 func playlistList(client *miniserver.Client) miniserver.Response {
@@ -139,18 +122,14 @@ func playlistList(client *miniserver.Client) miniserver.Response {
 	if err != nil {
 		return client.CreateResponse(utils.StatusInvalid)
 	}
+	request.UserId = middleware.User(client).Id
 
-	usersDB := database.GetDefaultDatabase().UsersDB
 	playlistsDB := database.GetDefaultDatabase().PlaylistsDB
-
-	if requester, err := usersDB.FindUserByApiKey(request.ApiKey); err == nil && *requester.Verified {
-		playlists, err := playlistsDB.GetPlaylists(request.ApiKey, false)
-		if err == nil {
-			return client.CreateJsonResponse(playlists)
-		}
+	playlists, err := playlistsDB.GetPlaylists(request.UserId, false)
+	if err != nil {
+		return client.CreateResponse(databaseStatus(err))
 	}
-
-	return client.CreateResponse(utils.StatusInvalid)
+	return client.CreateJsonResponse(playlists)
 }
 
 func playlistListPublic(client *miniserver.Client) miniserver.Response {
@@ -159,39 +138,31 @@ func playlistListPublic(client *miniserver.Client) miniserver.Response {
 		return client.CreateResponse(utils.StatusInvalid)
 	}
 
-	usersDB := database.GetDefaultDatabase().UsersDB
+	user, err := database.GetDefaultDatabase().UsersDB.FindUserByName(request.Name)
+	if err != nil {
+		return client.CreateResponse(utils.StatusNotFound)
+	}
 	playlistsDB := database.GetDefaultDatabase().PlaylistsDB
-	if requester, err := usersDB.FindUserByApiKey(request.ApiKey); err == nil && *requester.Verified {
-
-		user, err := usersDB.FindUserByName(request.Name)
-		if err == nil {
-			playlists, err := playlistsDB.GetPlaylists(user.ApiKey, true)
-			if err == nil {
-				return client.CreateJsonResponse(playlists)
-			}
-		}
+	playlists, err := playlistsDB.GetPlaylists(user.Id, true)
+	if err != nil {
+		return client.CreateResponse(databaseStatus(err))
 	}
-
-	return client.CreateResponse(utils.StatusInvalid)
+	return client.CreateJsonResponse(playlists)
 }
 
 func playlistCreate(client *miniserver.Client) miniserver.Response {
 	request, err := database.NewPlaylist(client.Request)
-	if err != nil {
+	if err != nil || utils.StringIsEmpty(request.Name) {
 		return client.CreateResponse(utils.StatusInvalid)
 	}
+	request.UserId = middleware.User(client).Id
 
-	usersDB := database.GetDefaultDatabase().UsersDB
 	playlistsDB := database.GetDefaultDatabase().PlaylistsDB
-	if requester, err := usersDB.FindUserByApiKey(request.ApiKey); err == nil && *requester.Verified {
-
-		err := playlistsDB.CreatePlaylist(request)
-		if err == nil {
-			return client.CreateResponse(utils.StatusNoError)
-		}
+	if err := playlistsDB.CreatePlaylist(request); err != nil {
+		// Name and apikey are unique together
+		return client.CreateResponse(utils.StatusPlaylistAlreadyExists)
 	}
-
-	return client.CreateResponse(utils.StatusInvalid)
+	return client.CreateResponse(utils.StatusNoError)
 }
 
 func playlistDelete(client *miniserver.Client) miniserver.Response {
@@ -199,14 +170,11 @@ func playlistDelete(client *miniserver.Client) miniserver.Response {
 	if err != nil {
 		return client.CreateResponse(utils.StatusInvalid)
 	}
+	request.UserId = middleware.User(client).Id
 
 	playlistsDB := database.GetDefaultDatabase().PlaylistsDB
 	err = playlistsDB.DeletePlaylist(request)
-	if err == nil {
-		return client.CreateResponse(utils.StatusNoError)
-	}
-
-	return client.CreateResponse(utils.StatusInvalid)
+	return client.CreateResponse(databaseStatus(err))
 }
 
 func playlistSetPublic(client *miniserver.Client) miniserver.Response {
@@ -214,14 +182,11 @@ func playlistSetPublic(client *miniserver.Client) miniserver.Response {
 	if err != nil {
 		return client.CreateResponse(utils.StatusInvalid)
 	}
+	request.UserId = middleware.User(client).Id
 
 	playlistsDB := database.GetDefaultDatabase().PlaylistsDB
 	err = playlistsDB.SetPublic(request)
-	if err == nil {
-		return client.CreateResponse(utils.StatusNoError)
-	}
-
-	return client.CreateResponse(utils.StatusInvalid)
+	return client.CreateResponse(databaseStatus(err))
 }
 
 func playlistListIds(client *miniserver.Client) miniserver.Response {
@@ -229,14 +194,14 @@ func playlistListIds(client *miniserver.Client) miniserver.Response {
 	if err != nil {
 		return client.CreateResponse(utils.StatusInvalid)
 	}
+	request.UserId = middleware.User(client).Id
 
 	playlistsDB := database.GetDefaultDatabase().PlaylistsDB
 	ids, err := playlistsDB.GetPlaylistIds(request)
-	if err == nil {
-		return client.CreateJsonResponse(ids)
+	if err != nil {
+		return client.CreateResponse(databaseStatus(err))
 	}
-
-	return client.CreateResponse(utils.StatusInvalid)
+	return client.CreateJsonResponse(ids)
 }
 
 func playlistListIdsPublic(client *miniserver.Client) miniserver.Response {
@@ -245,22 +210,21 @@ func playlistListIdsPublic(client *miniserver.Client) miniserver.Response {
 		return client.CreateResponse(utils.StatusInvalid)
 	}
 
-	usersDB := database.GetDefaultDatabase().UsersDB
+	user, err := database.GetDefaultDatabase().UsersDB.FindUserByName(request.Name)
+	if err != nil {
+		return client.CreateResponse(utils.StatusNotFound)
+	}
 	playlistsDB := database.GetDefaultDatabase().PlaylistsDB
-	if requester, err := usersDB.FindUserByApiKey(request.ApiKey); err == nil && *requester.Verified {
-		user, err := usersDB.FindUserByName(request.Name)
-		if err == nil {
-			playlist := database.Playlist{ApiKey: user.ApiKey, Name: request.Playlist}
-			if playlistsDB.IsPlaylistPublic(playlist) {
-				ids, err := playlistsDB.GetPlaylistIds(playlist)
-				if err == nil {
-					return client.CreateJsonResponse(ids)
-				}
-			}
-		}
+	playlist := database.Playlist{UserId: user.Id, Name: request.Playlist}
+	// Private playlists look the same as missing ones to others
+	if !playlistsDB.IsPlaylistPublic(playlist) {
+		return client.CreateResponse(utils.StatusNotFound)
 	}
-
-	return client.CreateResponse(utils.StatusInvalid)
+	ids, err := playlistsDB.GetPlaylistIds(playlist)
+	if err != nil {
+		return client.CreateResponse(databaseStatus(err))
+	}
+	return client.CreateJsonResponse(ids)
 }
 
 func playlistAddId(client *miniserver.Client) miniserver.Response {
@@ -269,20 +233,20 @@ func playlistAddId(client *miniserver.Client) miniserver.Response {
 		return client.CreateResponse(utils.StatusInvalid)
 	}
 
-	usersDB := database.GetDefaultDatabase().UsersDB
-	playlistsDB := database.GetDefaultDatabase().PlaylistsDB
-	if requester, err := usersDB.FindUserByApiKey(request.ApiKey); err == nil && *requester.Verified {
-		err = playlistsDB.AddIdToPlaylist(request)
-		if err != nil {
-			return client.CreateResponse(utils.StatusPlaylistIdAlreadyExists)
-		}
+	requester := middleware.User(client)
+	request.UserId = requester.Id
 
-		logger.I(client.IPAddr + ": " + requester.Name + " adding " +
-			request.Id + " to playlist " + request.Name)
-		return client.CreateResponse(utils.StatusNoError)
+	playlistsDB := database.GetDefaultDatabase().PlaylistsDB
+	err = playlistsDB.AddIdToPlaylist(request)
+	if err == sql.ErrNoRows {
+		return client.CreateResponse(utils.StatusNotFound)
+	} else if err != nil {
+		return client.CreateResponse(utils.StatusPlaylistIdAlreadyExists)
 	}
 
-	return client.CreateResponse(utils.StatusInvalid)
+	logger.I(client.IPAddr + ": " + requester.Name + " adding " +
+		request.Id + " to playlist " + request.Name)
+	return client.CreateResponse(utils.StatusNoError)
 }
 
 func playlistDeleteId(client *miniserver.Client) miniserver.Response {
@@ -290,17 +254,14 @@ func playlistDeleteId(client *miniserver.Client) miniserver.Response {
 	if err != nil {
 		return client.CreateResponse(utils.StatusInvalid)
 	}
+	request.UserId = middleware.User(client).Id
 
-	usersDB := database.GetDefaultDatabase().UsersDB
 	playlistsDB := database.GetDefaultDatabase().PlaylistsDB
-	if requester, err := usersDB.FindUserByApiKey(request.ApiKey); err == nil && *requester.Verified {
-		err := playlistsDB.DeleteIdFromPlaylist(request)
-		if err == nil {
-			return client.CreateResponse(utils.StatusNoError)
-		}
+	err = playlistsDB.DeleteIdFromPlaylist(request)
+	if err == database.ErrIdNotFound {
+		return client.CreateResponse(utils.StatusNotFound)
 	}
-
-	return client.CreateResponse(utils.StatusInvalid)
+	return client.CreateResponse(databaseStatus(err))
 }
 
 func playlistSetIds(client *miniserver.Client) miniserver.Response {
@@ -308,17 +269,14 @@ func playlistSetIds(client *miniserver.Client) miniserver.Response {
 	if err != nil {
 		return client.CreateResponse(utils.StatusInvalid)
 	}
+	request.UserId = middleware.User(client).Id
 
-	usersDB := database.GetDefaultDatabase().UsersDB
 	playlistsDB := database.GetDefaultDatabase().PlaylistsDB
-	if requester, err := usersDB.FindUserByApiKey(request.ApiKey); err == nil && *requester.Verified {
-		err := playlistsDB.SetPlaylistIds(request)
-		if err == nil {
-			return client.CreateResponse(utils.StatusNoError)
-		}
+	err = playlistsDB.SetPlaylistIds(request)
+	if err == database.ErrDuplicateIds {
+		return client.CreateResponse(utils.StatusInvalid)
 	}
-
-	return client.CreateResponse(utils.StatusInvalid)
+	return client.CreateResponse(databaseStatus(err))
 }
 
 func historyAdd(client *miniserver.Client) miniserver.Response {
@@ -327,18 +285,16 @@ func historyAdd(client *miniserver.Client) miniserver.Response {
 		return client.CreateResponse(utils.StatusInvalid)
 	}
 
-	userDB := database.GetDefaultDatabase().UsersDB
+	requester := middleware.User(client)
+	request.UserId = requester.Id
+
 	historiesDB := database.GetDefaultDatabase().HistoriesDB
-	if requester, err := userDB.FindUserByApiKey(request.ApiKey); err == nil && *requester.Verified {
-		err = historiesDB.AddHistory(request.ApiKey, request.Id)
-		if err == nil {
-			logger.I(client.IPAddr + ": " + requester.Name +
-				" adding " + request.Id + " to history")
-			return client.CreateResponse(utils.StatusNoError)
-		}
+	if err := historiesDB.AddHistory(request.UserId, request.Id); err != nil {
+		return client.CreateResponse(utils.StatusAddHistoryFailed)
 	}
-
-	return client.CreateResponse(utils.StatusInvalid)
+	logger.I(client.IPAddr + ": " + requester.Name +
+		" adding " + request.Id + " to history")
+	return client.CreateResponse(utils.StatusNoError)
 }
 
 func historyList(client *miniserver.Client) miniserver.Response {
@@ -346,67 +302,95 @@ func historyList(client *miniserver.Client) miniserver.Response {
 	if err != nil {
 		return client.CreateResponse(utils.StatusInvalid)
 	}
+	request.UserId = middleware.User(client).Id
 
 	historiesDB := database.GetDefaultDatabase().HistoriesDB
-	histories, err := historiesDB.GetHistory(request.ApiKey)
-	if err == nil {
-		return client.CreateJsonResponse(histories)
+	histories, err := historiesDB.GetHistory(request.UserId)
+	if err != nil {
+		return client.CreateResponse(databaseStatus(err))
 	}
-
-	return client.CreateResponse(utils.StatusInvalid)
+	return client.CreateJsonResponse(histories)
 }
 
-func HandleUsersV1(path string, client *miniserver.Client) miniserver.Response {
-	if client.Method != http.MethodPost || !client.IsContentJson() {
-		return nil
+// databaseStatus maps the result of a database call to a status code
+func databaseStatus(err error) int {
+	switch err {
+	case nil:
+		return utils.StatusNoError
+	case sql.ErrNoRows:
+		return utils.StatusNotFound
 	}
+	logger.E(err)
+	return utils.StatusInternalError
+}
 
-	switch path {
+func RegisterUsersV1(group *miniserver.RouteGroup) {
+	group.Use(miniserver.RequireJson)
+	status := miniserver.StatusResponse{}
 
 	// user database
-	case "signup":
-		return usersSignUp(client)
-	case "login":
-		return usersLogin(client)
-	case "list":
-		return usersList(client)
-	case "setverification":
-		return usersSetVerification(client)
-	case "delete":
-		return usersDelete(client)
-	case "deleteall":
-		return usersDeleteAll(client)
-	case "resetpassword":
-		return usersResetPassword(client)
-
-		// playlist database
-	case "playlist/list":
-		return playlistList(client)
-	case "playlist/listpublic":
-		return playlistListPublic(client)
-	case "playlist/create":
-		return playlistCreate(client)
-	case "playlist/delete":
-		return playlistDelete(client)
-	case "playlist/setpublic":
-		return playlistSetPublic(client)
-	case "playlist/listids":
-		return playlistListIds(client)
-	case "playlist/listidspublic":
-		return playlistListIdsPublic(client)
-	case "playlist/addid":
-		return playlistAddId(client)
-	case "playlist/deleteid":
-		return playlistDeleteId(client)
-	case "playlist/setids":
-		return playlistSetIds(client)
-
-		// history database
-	case "history/add":
-		return historyAdd(client)
-	case "history/list":
-		return historyList(client)
-	}
-
-	return nil
+	group.Post("signup", usersSignUp, middleware.RateLimit(middleware.LimitAuth)).
+		Describe("Create a user, the first one becomes admin").
+		Accepts(database.User{}).Returns(database.User{})
+	group.Post("login", usersLogin, middleware.RateLimitLogin(middleware.LimitAuth)).
+		Describe("Get the apikey of a user").
+		Accepts(database.User{}).Returns(database.User{})
+	group.Post("list", usersList, middleware.RequireUser).
+		Describe("List the users").Query("page", "Page starting at 1").
+		Accepts(database.User{}).Returns([]database.User{})
+	group.Post("setverification", usersSetVerification, middleware.RequireAdmin).
+		Describe("Verify or unverify a user").
+		Accepts(database.User{}).Returns(status)
+	group.Post("delete", usersDelete, middleware.RequireAdmin).
+		Describe("Delete a user").
+		Accepts(database.User{}).Returns(status)
+	group.Post("deleteall", usersDeleteAll, middleware.RequireAdmin).
+		Describe("Delete all users which aren't verified").
+		Accepts(database.User{}).Returns(status)
+	group.Post("resetpassword", usersResetPassword, middleware.RequireAdmin).
+		Describe("Set a new password for a user").
+		Accepts(database.User{}).Returns(status)
+
+	// playlist database
+	playlists := group.Group("playlist", middleware.RequireUser)
+	playlists.Post("list", playlistList).
+		Describe("List the own playlists").
+		Accepts(database.Playlist{}).Returns([]database.Playlist{})
+	playlists.Post("listpublic", playlistListPublic).
+		Describe("List the public playlists of the user in name").
+		Accepts(database.Playlist{}).Returns([]database.Playlist{})
+	playlists.Post("create", playlistCreate).
+		Describe("Create a playlist").
+		Accepts(database.Playlist{}).Returns(status)
+	playlists.Post("delete", playlistDelete).
+		Describe("Delete a playlist").
+		Accepts(database.Playlist{}).Returns(status)
+	playlists.Post("setpublic", playlistSetPublic).
+		Describe("Publish or hide a playlist").
+		Accepts(database.Playlist{}).Returns(status)
+	playlists.Post("listids", playlistListIds).
+		Describe("List the videos of a playlist").
+		Accepts(database.Playlist{}).Returns([]string{})
+	playlists.Post("listidspublic", playlistListIdsPublic).
+		Describe("List the videos of a public playlist of another user").
+		Accepts(database.PlaylistLinkPublic{}).Returns([]string{})
+	playlists.Post("addid", playlistAddId).
+		Describe("Add a video to a playlist").
+		Accepts(database.PlaylistId{}).Returns(status)
+	playlists.Post("deleteid", playlistDeleteId).
+		Describe("Remove a video from a playlist").
+		Accepts(database.PlaylistId{}).Returns(status)
+	// whole playlists get sent at once
+	playlists.Post("setids", playlistSetIds).MaxBodySize(1024 * 1024).
+		Describe("Replace the videos of a playlist").
+		Accepts(database.PlaylistIds{}).Returns(status)
+
+	// history database
+	histories := group.Group("history", middleware.RequireUser)
+	histories.Post("add", historyAdd).
+		Describe("Add a video to the history").
+		Accepts(database.History{}).Returns(status)
+	histories.Post("list", historyList).
+		Describe("List the history, latest first").
+		Accepts(database.History{}).Returns([]string{})
 }
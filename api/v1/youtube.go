@@ -1,10 +1,11 @@
 package v1
 
 import (
-	"net/http"
+	"encoding/json"
 	"net/url"
 	"strings"
 
+	"github.com/Grarak/GoYTFetcher/api/middleware"
 	"github.com/Grarak/GoYTFetcher/database"
 	"github.com/Grarak/GoYTFetcher/logger"
 	"github.com/Grarak/GoYTFetcher/miniserver"
@@ -17,66 +18,73 @@ func youtubeFetch(client *miniserver.Client) miniserver.Response {
 		return client.CreateResponse(utils.StatusInvalid)
 	}
 
-	usersDB := database.GetDefaultDatabase().UsersDB
-	if requester, err := usersDB.FindUserByApiKey(request.ApiKey); err == nil && *requester.Verified {
-		logger.I(client.IPAddr + ": " + requester.Name + " fetching " + request.Id)
-		youtubeDB := database.GetDefaultDatabase().YoutubeDB
-		u, id, err := youtubeDB.FetchYoutubeSong(request.Id)
-		if err != nil {
-			logger.E(err)
-			return client.CreateResponse(utils.StatusYoutubeFetchFailure)
-		}
+	requester := middleware.User(client)
 
-		if request.AddHistory {
-			err := database.GetDefaultDatabase().HistoriesDB.AddHistory(request.ApiKey, request.Id)
-			if err != nil {
-				return client.CreateResponse(utils.StatusAddHistoryFailed)
-			}
+	logger.I(client.IPAddr + ": " + requester.Name + " fetching " + request.Id)
+	youtubeDB := database.GetDefaultDatabase().YoutubeDB
+	u, id, err := youtubeDB.FetchYoutubeSong(request.Id)
+	if err == database.ErrInvalidVideoId {
+		return client.CreateResponse(utils.StatusInvalid)
+	} else if err != nil {
+		logger.E(err)
+		return client.CreateResponse(utils.StatusYoutubeFetchFailure)
+	}
+
+	if request.AddHistory {
+		err := database.GetDefaultDatabase().HistoriesDB.AddHistory(requester.Id, request.Id)
+		if err != nil {
+			return client.CreateResponse(utils.StatusAddHistoryFailed)
 		}
-		if !strings.HasPrefix(u, "http") {
-			query := url.Values{}
-			query.Set("id", u)
-
-			if purl, err := url.Parse(u); err == nil {
-				host := purl.Host
-				if !strings.HasPrefix(host, "http") {
-					host = "http://" + client.Host
-				}
-				u = host + strings.Replace(
-					client.Url, "fetch", "get", 1) + "?" + query.Encode()
+	}
+	if !strings.HasPrefix(u, "http") {
+		// Players open the url without the apikey, it's signed instead
+		path := strings.Replace(client.Url, "fetch", "get", 1)
+		query := middleware.SignUrl(path, u)
+
+		if purl, err := url.Parse(u); err == nil {
+			host := purl.Host
+			if !strings.HasPrefix(host, "http") {
+				host = "http://" + client.Host
 			}
+			u = host + path + "?" + query.Encode()
 		}
-
-		response := client.ResponseBody(u)
-		response.SetHeader("ytfetcher-id", id)
-		return response
 	}
 
-	return client.CreateResponse(utils.StatusInvalid)
+	response := client.ResponseBody(u)
+	response.SetHeader("ytfetcher-id", id)
+	return response
 }
 
 func youtubeGet(client *miniserver.Client) miniserver.Response {
 	id := client.Queries.Get("id")
 	u := client.Queries.Get("url")
+	if utils.StringIsEmpty(id) {
+		return client.CreateResponse(utils.StatusInvalid)
+	}
 
-	if !utils.StringIsEmpty(id) {
-		youtubeSong, err := database.GetDefaultDatabase().YoutubeDB.GetYoutubeSong(id)
-		if err != nil {
-			return client.CreateResponse(utils.StatusYoutubeGetFailure)
-		}
-		if strings.Contains(u, "googlevideo") {
-			return miniserver.NewForwardResponse(u)
-		}
+	youtubeSong, err := database.GetDefaultDatabase().YoutubeDB.GetYoutubeSong(id)
+	if err != nil {
+		return client.CreateResponse(utils.StatusYoutubeGetFailure)
+	}
+	if purl, err := url.Parse(u); err == nil && isGooglevideoHost(purl.Hostname()) {
+		response := miniserver.NewForwardResponse(u)
+		response.SetRefresh(youtubeSong.RefreshDownloadUrl)
+		return middleware.ServedBytes(response, middleware.SourceProxy)
+	}
 
-		reader, err := youtubeSong.Reader()
-		if err == nil {
-			response := client.ResponseReader(reader)
-			response.SetContentType(miniserver.ContentOgg)
-			return response
-		}
+	reader, err := youtubeSong.Reader()
+	if err != nil {
+		// Not downloaded yet or already evicted
+		return client.CreateResponse(utils.StatusYoutubeGetFailure)
 	}
+	response := client.ResponseReader(reader)
+	response.SetContentType(miniserver.ContentOgg)
+	return middleware.ServedBytes(response, middleware.SourceLocal)
+}
 
-	return client.CreateResponse(utils.StatusInvalid)
+// isGooglevideoHost makes sure youtube/get can't be abused as open proxy
+func isGooglevideoHost(host string) bool {
+	return host == "googlevideo.com" || strings.HasSuffix(host, ".googlevideo.com")
 }
 
 func youtubeSearch(client *miniserver.Client) miniserver.Response {
@@ -85,18 +93,17 @@ func youtubeSearch(client *miniserver.Client) miniserver.Response {
 		return client.CreateResponse(utils.StatusInvalid)
 	}
 
-	usersDB := database.GetDefaultDatabase().UsersDB
-	if requester, err := usersDB.FindUserByApiKey(request.ApiKey); err == nil && *requester.Verified {
-
-		logger.I(client.IPAddr + ": " + requester.Name + " searching " + request.SearchQuery)
-		results, err := database.GetDefaultDatabase().YoutubeDB.GetYoutubeSearch(request.SearchQuery)
-		if err != nil {
-			return client.CreateResponse(utils.StatusYoutubeSearchFailure)
-		}
-		return client.CreateJsonResponse(results)
+	requester := middleware.User(client)
+	if utils.StringIsEmpty(strings.TrimSpace(request.SearchQuery)) {
+		return client.CreateResponse(utils.StatusInvalid)
 	}
 
-	return client.CreateResponse(utils.StatusInvalid)
+	logger.I(client.IPAddr + ": " + requester.Name + " searching " + request.SearchQuery)
+	results, err := database.GetDefaultDatabase().YoutubeDB.GetYoutubeSearch(request.SearchQuery)
+	if err != nil {
+		return client.CreateResponse(utils.StatusYoutubeSearchFailure)
+	}
+	return client.CreateJsonResponse(results)
 }
 
 func youtubeGetInfo(client *miniserver.Client) miniserver.Response {
@@ -105,63 +112,115 @@ func youtubeGetInfo(client *miniserver.Client) miniserver.Response {
 		return client.CreateResponse(utils.StatusInvalid)
 	}
 
-	usersDB := database.GetDefaultDatabase().UsersDB
-	if requester, err := usersDB.FindUserByApiKey(request.ApiKey); err == nil && *requester.Verified {
-		info, err := database.GetDefaultDatabase().YoutubeDB.GetYoutubeInfo(request.Id)
-		if err != nil {
-			return client.CreateResponse(utils.StatusYoutubeGetInfoFailure)
-		}
-		return client.CreateJsonResponse(info)
+	if utils.StringIsEmpty(strings.TrimSpace(request.Id)) {
+		return client.CreateResponse(utils.StatusInvalid)
 	}
 
-	return client.CreateResponse(utils.StatusInvalid)
+	info, err := database.GetDefaultDatabase().YoutubeDB.GetYoutubeInfo(request.Id)
+	if err != nil {
+		return client.CreateResponse(utils.StatusYoutubeGetInfoFailure)
+	}
+	return client.CreateJsonResponse(info)
 }
 
-func youtubeGetCharts(client *miniserver.Client) miniserver.Response {
+// youtubeGetInfos resolves the infos of a whole playlist at once,
+// ids which fail carry their own status code
+func youtubeGetInfos(client *miniserver.Client) miniserver.Response {
 	request, err := database.NewYoutube(client.Request)
-	if err != nil {
+	if err != nil || len(request.Ids) == 0 || len(request.Ids) > database.MaxYoutubeInfos {
 		return client.CreateResponse(utils.StatusInvalid)
 	}
 
-	usersDB := database.GetDefaultDatabase().UsersDB
-	if requester, err := usersDB.FindUserByApiKey(request.ApiKey); err == nil && *requester.Verified {
-		info, err := database.GetDefaultDatabase().YoutubeDB.GetYoutubeCharts()
-		if err != nil {
-			return client.CreateResponse(utils.StatusYoutubeGetChartsFailure)
-		}
-		return client.CreateJsonResponse(info)
+	infos := database.GetDefaultDatabase().YoutubeDB.GetYoutubeInfos(request.Ids)
+	return client.CreateJsonResponse(infos)
+}
+
+func youtubeGetCharts(client *miniserver.Client) miniserver.Response {
+	if _, err := database.NewYoutube(client.Request); err != nil {
+		return client.CreateResponse(utils.StatusInvalid)
 	}
 
-	return client.CreateResponse(utils.StatusInvalid)
+	info, err := database.GetDefaultDatabase().YoutubeDB.GetYoutubeCharts()
+	if err != nil {
+		return client.CreateResponse(utils.StatusYoutubeGetChartsFailure)
+	}
+	return client.CreateJsonResponse(info)
 }
 
-func HandleYoutubeV1(path string, client *miniserver.Client) miniserver.Response {
-	switch path {
-	case "fetch":
-		if client.Method == http.MethodPost && client.IsContentJson() {
-			return youtubeFetch(client)
-		}
-		break
-	case "get":
-		if client.Method == http.MethodGet {
-			return youtubeGet(client)
-		}
-	case "search":
-		if client.Method == http.MethodPost && client.IsContentJson() {
-			return youtubeSearch(client)
-		}
-		break
-	case "getinfo":
-		if client.Method == http.MethodPost && client.IsContentJson() {
-			return youtubeGetInfo(client)
-		}
-		break
-	case "getcharts":
-		if client.Method == http.MethodPost && client.IsContentJson() {
-			return youtubeGetCharts(client)
-		}
-		break
+// youtubeEvents streams the download state of songs as server-sent events,
+// ids limits the stream to comma separated video or fetch ids, the songs
+// other users listen to are none of the requester's business
+func youtubeEvents(client *miniserver.Client) miniserver.Response {
+	if utils.StringIsEmpty(client.Queries.Get("ids")) {
+		return client.CreateResponse(utils.StatusInvalid)
 	}
+	ids := strings.Split(client.Queries.Get("ids"), ",")
+	if len(ids) > database.MaxYoutubeInfos {
+		return client.CreateResponse(utils.StatusInvalid)
+	}
+
+	songEvents, unsubscribe := database.GetDefaultDatabase().YoutubeDB.SubscribeSongEvents()
+	events := make(chan miniserver.ServerSentEvent)
+	stop := make(chan struct{})
+	go func() {
+		defer close(events)
+		for songEvent := range songEvents {
+			if !utils.StringArrayContains(ids, songEvent.Id) &&
+				!utils.StringArrayContains(ids, songEvent.FetchId) {
+				continue
+			}
+			data, err := json.Marshal(songEvent)
+			if err != nil {
+				continue
+			}
+			select {
+			case events <- miniserver.ServerSentEvent{Event: songEvent.State, Data: data}:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return miniserver.NewEventStreamResponse(events, func() {
+		close(stop)
+		unsubscribe()
+	})
+}
 
-	return nil
+func RegisterYoutubeV1(group *miniserver.RouteGroup) {
+	group.Post("fetch", youtubeFetch, miniserver.RequireJson, middleware.RequireUser,
+		middleware.RateLimit(middleware.LimitFetch)).
+		Describe("Get the audio url of a video, the ytfetcher-id header identifies the song").
+		Accepts(database.Youtube{}).Produces(miniserver.ContentText)
+	group.Get("get", youtubeGet, middleware.ApiKeyQuery, middleware.RequireUserOrSignature,
+		middleware.RateLimit(middleware.LimitGet)).
+		Describe("Stream the audio of a fetched song").
+		Query("apikey", "For players, which can't set headers").
+		Query("id", "ytfetcher-id of the song").
+		Query("expires", "Expiry of the url fetch returned").
+		Query("signature", "Signature of the url fetch returned, replaces the apikey").
+		Query("url", "googlevideo url to proxy while the song downloads").
+		Produces(miniserver.ContentOgg)
+	group.Get("events", youtubeEvents, middleware.ApiKeyQuery, middleware.RequireUser,
+		middleware.RateLimit(middleware.LimitSearch)).
+		Describe("Server-sent events with the download state of songs").
+		Query("apikey", "For EventSource, which can't set headers").
+		Query("ids", "Comma separated video or ytfetcher-ids, up to 100, required").
+		Produces(miniserver.ContentEventStream)
+	group.Post("search", youtubeSearch, miniserver.RequireJson, middleware.RequireUser,
+		middleware.RateLimit(middleware.LimitSearch)).
+		Describe("Search youtube").
+		Accepts(database.Youtube{}).Returns([]database.YoutubeSearchResult{})
+	group.Post("getinfo", youtubeGetInfo, miniserver.RequireJson, middleware.RequireUser,
+		middleware.RateLimit(middleware.LimitSearch)).
+		Describe("Get title, thumbnail and duration of a video").
+		Accepts(database.Youtube{}).Returns(database.YoutubeSearchResult{})
+	group.Post("getinfos", youtubeGetInfos, miniserver.RequireJson, middleware.RequireUser,
+		middleware.RateLimit(middleware.LimitSearch)).
+		Describe("Get the infos of up to 100 videos in ids").
+		Accepts(database.Youtube{}).Returns([]database.YoutubeInfo{})
+	group.Post("getcharts", youtubeGetCharts, miniserver.RequireJson, middleware.RequireUser,
+		middleware.RateLimit(middleware.LimitSearch)).
+		Describe("Get the trending music videos").
+		Accepts(database.Youtube{}).Returns([]database.YoutubeSearchResult{})
 }
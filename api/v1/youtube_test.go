@@ -0,0 +1,142 @@
+package v1
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Grarak/GoYTFetcher/api/middleware"
+	"github.com/Grarak/GoYTFetcher/database"
+	"github.com/Grarak/GoYTFetcher/logger"
+	"github.com/Grarak/GoYTFetcher/miniserver"
+	"github.com/Grarak/GoYTFetcher/utils"
+)
+
+const testVideoId = "dQw4w9WgXcQ"
+
+var testSong = []byte("OggS song")
+
+// newTestServer serves the youtube api from a temporary directory,
+// the song is downloaded already, so nothing talks to youtube
+func newTestServer(t *testing.T) (string, string) {
+	dir, err := ioutil.TempDir("", "ytfetcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	workDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(workDir)
+		os.RemoveAll(dir)
+	})
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// The youtube database only looks youtube-dl up
+	youtubeDL := filepath.Join(dir, utils.YOUTUBE_DL)
+	if err := ioutil.WriteFile(youtubeDL, []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	utils.Panic(utils.MkDir(utils.DATABASE))
+	utils.Panic(utils.MkDir(utils.YOUTUBE_DIR))
+	utils.Panic(ioutil.WriteFile(utils.YOUTUBE_DIR+"/"+testVideoId+".ogg", testSong, 0644))
+	logger.Init()
+
+	db := database.GetDatabase(utils.GenerateRandom(16), "")
+	user, code := db.UsersDB.AddUser(database.User{Name: "alice", Password: utils.Encode("password")})
+	if code != utils.StatusNoError {
+		t.Fatal(code)
+	}
+
+	router := miniserver.NewRouter()
+	RegisterYoutubeV1(router.Group("/api/v1/youtube", middleware.Authenticate))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	server := miniserver.NewServer(0)
+	server.AddListenAddress(address)
+	go server.StartListening(router.ServeClient)
+	t.Cleanup(server.StopListening)
+	for i := 0; i < 100; i++ {
+		if conn, err := net.Dial("tcp", address); err == nil {
+			conn.Close()
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return "http://" + address, user.ApiKey
+}
+
+func get(t *testing.T, u string) (int, []byte) {
+	response, err := http.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response.StatusCode, body
+}
+
+func TestFetchedUrlPlaysWithoutApiKey(t *testing.T) {
+	server, apiKey := newTestServer(t)
+
+	request, err := http.NewRequest(http.MethodPost, server+"/api/v1/youtube/fetch",
+		bytes.NewBufferString(`{"id": "`+testVideoId+`"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Content-Type", miniserver.ContentJson)
+	request.Header.Set("Authorization", "Bearer "+apiKey)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetched, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil || response.StatusCode != http.StatusOK {
+		t.Fatalf("fetch %d %s %v", response.StatusCode, fetched, err)
+	}
+
+	// Players open the url as it is, without headers or cookies
+	if status, body := get(t, string(fetched)); status != http.StatusOK || !bytes.Equal(body, testSong) {
+		t.Fatalf("get %d %q", status, body)
+	}
+
+	songUrl, err := url.Parse(string(fetched))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := songUrl.Query()
+	query.Set("signature", strings.Repeat("A", len(query.Get("signature"))))
+	songUrl.RawQuery = query.Encode()
+	if status, _ := get(t, songUrl.String()); status != http.StatusUnauthorized {
+		t.Errorf("forged signature %d", status)
+	}
+
+	query.Del("signature")
+	query.Del("expires")
+	songUrl.RawQuery = query.Encode()
+	if status, _ := get(t, songUrl.String()); status != http.StatusUnauthorized {
+		t.Errorf("unsigned url %d", status)
+	}
+}
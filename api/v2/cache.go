@@ -0,0 +1,102 @@
+package v2
+
+import (
+	"net/http"
+
+	"github.com/Grarak/GoYTFetcher/api/middleware"
+	"github.com/Grarak/GoYTFetcher/database"
+	"github.com/Grarak/GoYTFetcher/miniserver"
+	"github.com/Grarak/GoYTFetcher/utils"
+)
+
+// PurgedSearches is the answer of purging the searches
+type PurgedSearches struct {
+	Purged int `json:"purged"`
+}
+
+func cacheFailure(client *miniserver.Client, err error) miniserver.Response {
+	switch err {
+	case database.ErrNotCached:
+		return client.CreateResponse(utils.StatusNotFound)
+	case database.ErrSongDownloading:
+		return client.CreateResponse(utils.StatusSongDownloading)
+	case database.ErrShuttingDown:
+		return client.CreateResponse(utils.StatusShuttingDown)
+	}
+	return databaseFailure(client, err)
+}
+
+func uncachedJson(client *miniserver.Client, data interface{}) miniserver.Response {
+	response := client.CreateJsonResponse(data)
+	response.SetHeader("Cache-Control", "no-store")
+	return response
+}
+
+func cacheUsage(client *miniserver.Client) miniserver.Response {
+	usage, err := database.GetDefaultDatabase().YoutubeDB.CacheUsage()
+	if err != nil {
+		return databaseFailure(client, err)
+	}
+	return uncachedJson(client, usage)
+}
+
+func cacheSongs(client *miniserver.Client) miniserver.Response {
+	return uncachedJson(client, database.GetDefaultDatabase().YoutubeDB.ListCachedSongs())
+}
+
+func cacheSongEvict(client *miniserver.Client) miniserver.Response {
+	err := database.GetDefaultDatabase().YoutubeDB.EvictYoutubeSong(client.Param("id"))
+	if err != nil {
+		return cacheFailure(client, err)
+	}
+	return noContent(client)
+}
+
+func cacheSongDownload(client *miniserver.Client) miniserver.Response {
+	err := database.GetDefaultDatabase().YoutubeDB.RedownloadYoutubeSong(client.Param("id"))
+	if err != nil {
+		return cacheFailure(client, err)
+	}
+	response := client.CreateResponse(utils.StatusNoError)
+	response.SetStatusCode(http.StatusAccepted)
+	return response
+}
+
+func cacheSearches(client *miniserver.Client) miniserver.Response {
+	return uncachedJson(client, database.GetDefaultDatabase().YoutubeDB.ListCachedSearches())
+}
+
+func cacheSearchEvict(client *miniserver.Client) miniserver.Response {
+	err := database.GetDefaultDatabase().YoutubeDB.EvictYoutubeSearch(client.Param("query"))
+	if err != nil {
+		return cacheFailure(client, err)
+	}
+	return noContent(client)
+}
+
+func cacheSearchesPurge(client *miniserver.Client) miniserver.Response {
+	purged := database.GetDefaultDatabase().YoutubeDB.PurgeYoutubeSearches()
+	return client.CreateJsonResponse(PurgedSearches{purged})
+}
+
+// RegisterCacheV2 lets admins inspect and clean up what the server cached
+func RegisterCacheV2(group *miniserver.RouteGroup) {
+	group.Get("", cacheUsage, middleware.RequireAdmin).
+		Describe("Count the cache entries and the disk usage of the downloads").
+		Returns(database.CacheUsage{})
+	group.Get("songs", cacheSongs, middleware.RequireAdmin).
+		Describe("List the songs, the most recently used first").
+		Returns([]database.CachedSong{})
+	group.Delete("songs/{id}", cacheSongEvict, middleware.RequireAdmin).
+		Describe("Forget a song and remove its file")
+	group.Post("songs/{id}/download", cacheSongDownload, middleware.RequireAdmin).
+		Describe("Download a song again, e.g. if its file is corrupt").
+		Returns(miniserver.StatusResponse{})
+	group.Get("searches", cacheSearches, middleware.RequireAdmin).
+		Describe("List the searches, the most requested first").
+		Returns([]database.CachedSearch{})
+	group.Delete("searches", cacheSearchesPurge, middleware.RequireAdmin).
+		Describe("Forget all searches").Returns(PurgedSearches{})
+	group.Delete("searches/{query...}", cacheSearchEvict, middleware.RequireAdmin).
+		Describe("Forget a search")
+}
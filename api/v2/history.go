@@ -0,0 +1,27 @@
+package v2
+
+import (
+	"github.com/Grarak/GoYTFetcher/api/middleware"
+	"github.com/Grarak/GoYTFetcher/database"
+	"github.com/Grarak/GoYTFetcher/miniserver"
+	"github.com/Grarak/GoYTFetcher/utils"
+)
+
+func historyList(client *miniserver.Client) miniserver.Response {
+	user := middleware.User(client)
+	request, ok := pageRequest(client)
+	if !ok {
+		return client.CreateResponse(utils.StatusInvalid)
+	}
+
+	histories, err := database.GetDefaultDatabase().HistoriesDB.ListHistory(user.Id, request)
+	if err != nil {
+		return databaseFailure(client, err)
+	}
+	return cacheableJson(client, histories, 0)
+}
+
+func RegisterHistoryV2(group *miniserver.RouteGroup) {
+	pageQueries(group.Get("", historyList)).
+		Describe("List the history, latest first").Returns(database.IdsPage{})
+}
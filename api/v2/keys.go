@@ -0,0 +1,96 @@
+package v2
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/Grarak/GoYTFetcher/api/middleware"
+	"github.com/Grarak/GoYTFetcher/database"
+	"github.com/Grarak/GoYTFetcher/logger"
+	"github.com/Grarak/GoYTFetcher/miniserver"
+	"github.com/Grarak/GoYTFetcher/utils"
+)
+
+// apiKeyRequest names a key, it never expires without Expires
+type apiKeyRequest struct {
+	Name    string     `json:"name"`
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+func apiKeyFailure(client *miniserver.Client, err error) miniserver.Response {
+	switch err {
+	case database.ErrInvalidApiKeyName, database.ErrInvalidExpiry:
+		return client.CreateResponse(utils.StatusInvalid)
+	case sql.ErrNoRows:
+		return client.CreateResponse(utils.StatusNotFound)
+	}
+	return databaseFailure(client, err)
+}
+
+func keysList(client *miniserver.Client) miniserver.Response {
+	apiKeys, err := database.GetDefaultDatabase().UsersDB.ListApiKeys(middleware.User(client).Id)
+	if err != nil {
+		return databaseFailure(client, err)
+	}
+	return cacheableJson(client, apiKeys, 0)
+}
+
+func keysCreate(client *miniserver.Client) miniserver.Response {
+	var request apiKeyRequest
+	if err := json.Unmarshal(client.Request, &request); err != nil {
+		return client.CreateResponse(utils.StatusInvalid)
+	}
+
+	user := middleware.User(client)
+	apiKey, err := database.GetDefaultDatabase().UsersDB.CreateApiKey(
+		user.Id, request.Name, request.Expires)
+	if err != nil {
+		return apiKeyFailure(client, err)
+	}
+	logger.I(client.IPAddr + ": " + user.Name + " created apikey " + apiKey.Name)
+
+	response := client.CreateJsonResponse(apiKey)
+	response.SetStatusCode(http.StatusCreated)
+	response.SetHeader("Cache-Control", "no-store")
+	return response
+}
+
+func keysUpdate(client *miniserver.Client) miniserver.Response {
+	var request apiKeyRequest
+	if err := json.Unmarshal(client.Request, &request); err != nil {
+		return client.CreateResponse(utils.StatusInvalid)
+	}
+
+	err := database.GetDefaultDatabase().UsersDB.UpdateApiKey(middleware.User(client).Id,
+		database.ApiKey{Id: client.Param("id"), Name: request.Name, Expires: request.Expires})
+	if err != nil {
+		return apiKeyFailure(client, err)
+	}
+	return noContent(client)
+}
+
+func keysRevoke(client *miniserver.Client) miniserver.Response {
+	user := middleware.User(client)
+	err := database.GetDefaultDatabase().UsersDB.RevokeApiKey(user.Id, client.Param("id"))
+	if err != nil {
+		return apiKeyFailure(client, err)
+	}
+	logger.I(client.IPAddr + ": " + user.Name + " revoked apikey " + client.Param("id"))
+	return noContent(client)
+}
+
+func RegisterKeysV2(group *miniserver.RouteGroup) {
+	group.Get("", keysList).
+		Describe("List the own apikeys with their last use, without the keys themselves").
+		Returns([]database.ApiKey{})
+	group.Post("", keysCreate, miniserver.RequireJson).
+		Describe("Create an apikey, the key is only part of this response").
+		Accepts(apiKeyRequest{}).Returns(database.ApiKey{})
+	group.Put("{id}", keysUpdate, miniserver.RequireJson).
+		Describe("Rename an apikey and set or clear its expiry").
+		Accepts(apiKeyRequest{})
+	group.Delete("{id}", keysRevoke).
+		Describe("Revoke an apikey")
+}
@@ -0,0 +1,225 @@
+package v2
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Grarak/GoYTFetcher/api/middleware"
+	"github.com/Grarak/GoYTFetcher/database"
+	"github.com/Grarak/GoYTFetcher/miniserver"
+	"github.com/Grarak/GoYTFetcher/utils"
+)
+
+type playlistResource struct {
+	Name   string   `json:"name"`
+	Public bool     `json:"public"`
+	Items  []string `json:"items"`
+}
+
+// playlistUpdate is the body of PUT, fields which are left out stay untouched
+type playlistUpdate struct {
+	Public *bool    `json:"public"`
+	Items  []string `json:"items"`
+}
+
+type playlistItem struct {
+	Id string `json:"id"`
+}
+
+func getPlaylistResource(user database.User, name string) (playlistResource, error) {
+	playlistsDB := database.GetDefaultDatabase().PlaylistsDB
+	playlist, err := playlistsDB.GetPlaylist(user.Id, name)
+	if err != nil {
+		return playlistResource{}, err
+	}
+	ids, err := playlistsDB.GetPlaylistIds(database.Playlist{UserId: user.Id, Name: name})
+	if err != nil {
+		return playlistResource{}, err
+	}
+	return playlistResource{playlist.Name, playlist.Public, ids}, nil
+}
+
+func playlistsList(client *miniserver.Client) miniserver.Response {
+	user := middleware.User(client)
+
+	request, ok := pageRequest(client)
+	if !ok {
+		return client.CreateResponse(utils.StatusInvalid)
+	}
+	filter := database.PlaylistFilter{
+		Name: client.Queries.Get("name"),
+		Sort: client.Queries.Get("sort"),
+	}
+
+	playlists, err := database.GetDefaultDatabase().PlaylistsDB.ListPlaylists(user.Id, filter, request)
+	if err != nil {
+		return databaseFailure(client, err)
+	}
+	return cacheableJson(client, playlists, 0)
+}
+
+func playlistGet(client *miniserver.Client) miniserver.Response {
+	user := middleware.User(client)
+
+	playlist, err := getPlaylistResource(user, client.Param("name"))
+	if err != nil {
+		return databaseFailure(client, err)
+	}
+	return cacheableJson(client, playlist, 0)
+}
+
+// playlistPut creates the playlist or updates the given fields of an existing one
+func playlistPut(client *miniserver.Client) miniserver.Response {
+	user := middleware.User(client)
+
+	var request playlistUpdate
+	if err := json.Unmarshal(client.Request, &request); err != nil {
+		return client.CreateResponse(utils.StatusInvalid)
+	}
+
+	name := client.Param("name")
+	playlist := database.Playlist{UserId: user.Id, Name: name}
+	playlistsDB := database.GetDefaultDatabase().PlaylistsDB
+
+	statusCode := http.StatusOK
+	existing, err := playlistsDB.GetPlaylist(user.Id, name)
+	if err == sql.ErrNoRows {
+		if request.Public != nil {
+			playlist.Public = *request.Public
+		}
+		if err := playlistsDB.CreatePlaylist(playlist); err != nil {
+			return databaseFailure(client, err)
+		}
+		statusCode = http.StatusCreated
+	} else if err != nil {
+		return databaseFailure(client, err)
+	} else if request.Public != nil && *request.Public != existing.Public {
+		playlist.Public = *request.Public
+		if err := playlistsDB.SetPublic(playlist); err != nil {
+			return databaseFailure(client, err)
+		}
+	}
+
+	if request.Items != nil {
+		err := playlistsDB.SetPlaylistIds(database.PlaylistIds{
+			UserId: user.Id, Name: name, Ids: request.Items})
+		if err == database.ErrDuplicateIds {
+			return client.CreateResponse(utils.StatusInvalid)
+		} else if err != nil {
+			return databaseFailure(client, err)
+		}
+	}
+
+	resource, err := getPlaylistResource(user, name)
+	if err != nil {
+		return databaseFailure(client, err)
+	}
+	jsonResponse := client.CreateJsonResponse(resource)
+	jsonResponse.SetStatusCode(statusCode)
+	if statusCode == http.StatusCreated {
+		location := url.URL{Path: strings.TrimSuffix(client.Url, "/")}
+		jsonResponse.SetHeader("Location", location.EscapedPath())
+	}
+	return jsonResponse
+}
+
+func playlistDelete(client *miniserver.Client) miniserver.Response {
+	user := middleware.User(client)
+
+	playlistsDB := database.GetDefaultDatabase().PlaylistsDB
+	name := client.Param("name")
+	if _, err := playlistsDB.GetPlaylist(user.Id, name); err != nil {
+		return databaseFailure(client, err)
+	}
+	if err := playlistsDB.DeletePlaylist(database.Playlist{UserId: user.Id, Name: name}); err != nil {
+		return databaseFailure(client, err)
+	}
+	return noContent(client)
+}
+
+func playlistItems(client *miniserver.Client) miniserver.Response {
+	user := middleware.User(client)
+	request, ok := pageRequest(client)
+	if !ok {
+		return client.CreateResponse(utils.StatusInvalid)
+	}
+
+	ids, err := database.GetDefaultDatabase().PlaylistsDB.ListPlaylistIds(
+		database.Playlist{UserId: user.Id, Name: client.Param("name")}, request)
+	if err != nil {
+		return databaseFailure(client, err)
+	}
+	return cacheableJson(client, ids, 0)
+}
+
+func playlistAddItem(client *miniserver.Client) miniserver.Response {
+	user := middleware.User(client)
+
+	var item playlistItem
+	if err := json.Unmarshal(client.Request, &item); err != nil ||
+		utils.StringIsEmpty(strings.TrimSpace(item.Id)) {
+		return client.CreateResponse(utils.StatusInvalid)
+	}
+
+	playlistsDB := database.GetDefaultDatabase().PlaylistsDB
+	name := client.Param("name")
+	err := playlistsDB.AddIdToPlaylist(database.PlaylistId{
+		UserId: user.Id, Name: name, Id: strings.TrimSpace(item.Id)})
+	if err == database.ErrDuplicateIds {
+		return client.CreateResponse(utils.StatusPlaylistIdAlreadyExists)
+	} else if err != nil {
+		return databaseFailure(client, err)
+	}
+
+	resource, err := getPlaylistResource(user, name)
+	if err != nil {
+		return databaseFailure(client, err)
+	}
+	jsonResponse := client.CreateJsonResponse(resource)
+	jsonResponse.SetStatusCode(http.StatusCreated)
+	return jsonResponse
+}
+
+// playlistDeleteItem takes the id as query parameter, DELETE has no body
+func playlistDeleteItem(client *miniserver.Client) miniserver.Response {
+	user := middleware.User(client)
+
+	id := strings.TrimSpace(client.Queries.Get("id"))
+	if utils.StringIsEmpty(id) {
+		return client.CreateResponse(utils.StatusInvalid)
+	}
+
+	err := database.GetDefaultDatabase().PlaylistsDB.DeleteIdFromPlaylist(database.PlaylistId{
+		UserId: user.Id, Name: client.Param("name"), Id: id})
+	if err == database.ErrIdNotFound {
+		return client.CreateResponse(utils.StatusNotFound)
+	} else if err != nil {
+		return databaseFailure(client, err)
+	}
+	return noContent(client)
+}
+
+func RegisterPlaylistsV2(group *miniserver.RouteGroup) {
+	pageQueries(group.Get("", playlistsList)).
+		Describe("List the own playlists").
+		Query("name", "Only playlists whose name contains this").
+		Query("sort", "name (default) or -name").
+		Returns(database.PlaylistsPage{})
+	group.Get("{name}", playlistGet).
+		Describe("Get a playlist with its videos").Returns(playlistResource{})
+	group.Put("{name}", playlistPut, miniserver.RequireJson).
+		Describe("Create a playlist or update the given fields").
+		Accepts(playlistUpdate{}).Returns(playlistResource{})
+	group.Delete("{name}", playlistDelete).
+		Describe("Delete a playlist")
+	pageQueries(group.Get("{name}/items", playlistItems)).
+		Describe("List the videos of a playlist").Returns(database.IdsPage{})
+	group.Post("{name}/items", playlistAddItem, miniserver.RequireJson).
+		Describe("Add a video to a playlist").
+		Accepts(playlistItem{}).Returns(playlistResource{})
+	group.Delete("{name}/items", playlistDeleteItem).
+		Describe("Remove a video from a playlist").Query("id", "Video to remove")
+}
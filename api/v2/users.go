@@ -0,0 +1,47 @@
+package v2
+
+import (
+	"github.com/Grarak/GoYTFetcher/api/middleware"
+	"github.com/Grarak/GoYTFetcher/database"
+	"github.com/Grarak/GoYTFetcher/miniserver"
+	"github.com/Grarak/GoYTFetcher/utils"
+)
+
+func usersMe(client *miniserver.Client) miniserver.Response {
+	user := middleware.User(client)
+	return cacheableJson(client, database.User{
+		Name:     user.Name,
+		Admin:    user.Admin,
+		Verified: user.Verified,
+	}, 0)
+}
+
+func usersList(client *miniserver.Client) miniserver.Response {
+	request, ok := pageRequest(client)
+	verified, verifiedOk := boolQuery(client, "verified")
+	admin, adminOk := boolQuery(client, "admin")
+	if !ok || !verifiedOk || !adminOk {
+		return client.CreateResponse(utils.StatusInvalid)
+	}
+	filter := database.UserFilter{
+		Verified: verified,
+		Admin:    admin,
+		Sort:     client.Queries.Get("sort"),
+	}
+
+	users, err := database.GetDefaultDatabase().UsersDB.ListUsers(filter, request)
+	if err != nil {
+		return databaseFailure(client, err)
+	}
+	return cacheableJson(client, users, 0)
+}
+
+func RegisterUsersV2(group *miniserver.RouteGroup) {
+	pageQueries(group.Get("", usersList)).
+		Describe("List the users").
+		Query("verified", "true or false to only list (un)verified users").
+		Query("admin", "true or false to only list (non) admins").
+		Query("sort", "name (default) or -name").
+		Returns(database.UsersPage{})
+	group.Get("me", usersMe).Describe("Get the authenticated user").Returns(database.User{})
+}
@@ -0,0 +1,79 @@
+package v2
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Grarak/GoYTFetcher/database"
+	"github.com/Grarak/GoYTFetcher/logger"
+	"github.com/Grarak/GoYTFetcher/miniserver"
+	"github.com/Grarak/GoYTFetcher/utils"
+)
+
+// cacheableJson lets clients revalidate data with its ETag. Responses
+// differ per user, so only private caches may store them for maxAge
+func cacheableJson(client *miniserver.Client, data interface{}, maxAge time.Duration) *miniserver.SimpleResponse {
+	response := client.CreateJsonResponse(data)
+	response.EnableETag()
+	if maxAge > 0 {
+		response.SetHeader("Cache-Control", "private, max-age="+strconv.Itoa(int(maxAge.Seconds())))
+	} else {
+		response.SetHeader("Cache-Control", "private, no-cache")
+	}
+	response.SetHeader("Vary", "Authorization, Cookie")
+	return response
+}
+
+func noContent(client *miniserver.Client) *miniserver.SimpleResponse {
+	response := client.ResponseBodyBytes(nil)
+	response.SetContentType("")
+	response.SetStatusCode(http.StatusNoContent)
+	return response
+}
+
+func databaseFailure(client *miniserver.Client, err error) miniserver.Response {
+	switch err {
+	case sql.ErrNoRows:
+		return client.CreateResponse(utils.StatusNotFound)
+	case database.ErrInvalidCursor, database.ErrInvalidSort:
+		return client.CreateResponse(utils.StatusInvalid)
+	}
+	logger.E(err)
+	return client.CreateResponse(utils.StatusInternalError)
+}
+
+// pageRequest reads the cursor and limit query parameters of list endpoints
+func pageRequest(client *miniserver.Client) (database.PageRequest, bool) {
+	request := database.PageRequest{Cursor: client.Queries.Get("cursor")}
+	if limit := client.Queries.Get("limit"); !utils.StringIsEmpty(limit) {
+		size, err := strconv.Atoi(limit)
+		if err != nil || size <= 0 {
+			return request, false
+		}
+		request.Size = size
+	}
+	return request, true
+}
+
+// pageQueries documents the query parameters read by pageRequest
+func pageQueries(route *miniserver.Route) *miniserver.Route {
+	return route.
+		Query("cursor", "next of the previous page").
+		Query("limit", "Page size, "+strconv.Itoa(database.DefaultPageSize)+
+			" by default and at most "+strconv.Itoa(database.MaxPageSize))
+}
+
+// boolQuery reads an optional true or false query parameter
+func boolQuery(client *miniserver.Client, name string) (*bool, bool) {
+	value := client.Queries.Get(name)
+	if utils.StringIsEmpty(value) {
+		return nil, true
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, false
+	}
+	return &parsed, true
+}
@@ -0,0 +1,71 @@
+package v2
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Grarak/GoYTFetcher/api/middleware"
+	"github.com/Grarak/GoYTFetcher/database"
+	"github.com/Grarak/GoYTFetcher/miniserver"
+	"github.com/Grarak/GoYTFetcher/utils"
+)
+
+// Video infos hardly ever change, search results do once in a while
+const videoMaxAge = time.Hour
+const searchMaxAge = 10 * time.Minute
+
+func videoGet(client *miniserver.Client) miniserver.Response {
+	info, err := database.GetDefaultDatabase().YoutubeDB.GetYoutubeInfo(client.Param("id"))
+	if err != nil {
+		return client.CreateResponse(utils.StatusYoutubeGetInfoFailure)
+	}
+	return cacheableJson(client, info, videoMaxAge)
+}
+
+// videosList takes the ids comma separated, so the batch stays cacheable
+func videosList(client *miniserver.Client) miniserver.Response {
+	ids := strings.Split(client.Queries.Get("ids"), ",")
+	if utils.StringIsEmpty(client.Queries.Get("ids")) || len(ids) > database.MaxYoutubeInfos {
+		return client.CreateResponse(utils.StatusInvalid)
+	}
+
+	infos := database.GetDefaultDatabase().YoutubeDB.GetYoutubeInfos(ids)
+	response := cacheableJson(client, infos, videoMaxAge)
+	for _, info := range infos {
+		// Don't let clients cache failures for long
+		if info.StatusCode != utils.StatusNoError {
+			response.SetHeader("Cache-Control", "private, no-cache")
+			break
+		}
+	}
+	return response
+}
+
+func search(client *miniserver.Client) miniserver.Response {
+	query := strings.TrimSpace(client.Queries.Get("q"))
+	if utils.StringIsEmpty(query) {
+		return client.CreateResponse(utils.StatusInvalid)
+	}
+
+	results, err := database.GetDefaultDatabase().YoutubeDB.GetYoutubeSearch(query)
+	if err != nil {
+		return client.CreateResponse(utils.StatusYoutubeSearchFailure)
+	}
+	return cacheableJson(client, results, searchMaxAge)
+}
+
+func RegisterVideosV2(group *miniserver.RouteGroup) {
+	group.Get("", videosList, middleware.RateLimit(middleware.LimitSearch)).
+		Describe("Get the infos of up to 100 videos").
+		Query("ids", "Comma separated video ids").
+		Returns([]database.YoutubeInfo{})
+	group.Get("{id}", videoGet, middleware.RateLimit(middleware.LimitSearch)).
+		Describe("Get title, thumbnail and duration of a video").
+		Returns(database.YoutubeSearchResult{})
+}
+
+func RegisterSearchV2(group *miniserver.RouteGroup) {
+	group.Get("", search, middleware.RateLimit(middleware.LimitSearch)).
+		Describe("Search youtube").Query("q", "Search query").
+		Returns([]database.YoutubeSearchResult{})
+}
@@ -0,0 +1,307 @@
+package database
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Grarak/GoYTFetcher/utils"
+)
+
+const TableApiKeys = "apikeys"
+
+// Names of the apikeys which are created for users
+const (
+	SignupApiKeyName = "default"
+	LoginApiKeyName  = "login"
+)
+
+// lastUsedPrecision limits how often using a key is written to the database
+const lastUsedPrecision = time.Minute
+
+// Limits of the keys logins create, devices which log in
+// regularly keep their key, see CreateLoginApiKey
+const (
+	maxLoginApiKeys = 10
+	loginApiKeyIdle = 180 * 24 * time.Hour
+)
+
+var ErrInvalidApiKeyName = errors.New("invalid apikey name")
+var ErrInvalidExpiry = errors.New("expiry is in the past")
+
+// ApiKey is one of the keys of a user. Only a hash of the key is stored,
+// so Key is only known right after creating it
+type ApiKey struct {
+	Id       string     `json:"id"`
+	Name     string     `json:"name"`
+	Key      string     `json:"apikey,omitempty"`
+	Created  time.Time  `json:"created"`
+	LastUsed *time.Time `json:"lastused,omitempty"`
+	Expires  *time.Time `json:"expires,omitempty"`
+}
+
+func NewApiKey(data []byte) (ApiKey, error) {
+	var apiKey ApiKey
+	err := json.Unmarshal(data, &apiKey)
+	return apiKey, err
+}
+
+// execer is implemented by sql.DB and sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func apiKeysTable() string {
+	return newTableBuilder(TableApiKeys).
+		addForeignKey(foreignKey{ColumnUserId.name, text(), TableUsers,
+			ColumnUserId.name, false}).
+		addPrimaryKey(ColumnId).
+		addUniqueKeyPair(ColumnKeyHash).
+		addColumn(ColumnName).
+		addColumn(ColumnCreated).
+		addColumn(ColumnLastUsed).
+		addColumn(ColumnExpires).build()
+}
+
+func hashApiKey(apiKey string) string {
+	hash := sha256.Sum256([]byte(apiKey))
+	return utils.ToURLBase64(hash[:])
+}
+
+func generateApiKeyId() string {
+	return utils.ToURLBase64(utils.GenerateRandom(9))
+}
+
+func formatDateTime(date time.Time) string {
+	return date.UTC().Format(dateTimeFormat)
+}
+
+// nullTime scans datetime columns, the driver may return them
+// as time.Time or as the text they were stored as
+type nullTime struct {
+	time *time.Time
+}
+
+func (date *nullTime) Scan(value interface{}) error {
+	date.time = nil
+	switch value := value.(type) {
+	case nil:
+		return nil
+	case time.Time:
+		parsed := value.UTC()
+		date.time = &parsed
+		return nil
+	case []byte:
+		return date.Scan(string(value))
+	case string:
+		parsed, err := time.ParseInLocation(dateTimeFormat, value, time.UTC)
+		if err != nil {
+			return err
+		}
+		date.time = &parsed
+		return nil
+	}
+	return fmt.Errorf("can't scan %T into a datetime", value)
+}
+
+func validateApiKey(name string, expires *time.Time) error {
+	if utils.StringIsEmpty(name) || len(name) > 50 {
+		return ErrInvalidApiKeyName
+	}
+	if expires != nil && !expires.After(time.Now()) {
+		return ErrInvalidExpiry
+	}
+	return nil
+}
+
+// createApiKey expects the write lock to be held
+func (usersDB *UsersDB) createApiKey(db execer, userId, name string, expires *time.Time) (ApiKey, error) {
+	if err := validateApiKey(name, expires); err != nil {
+		return ApiKey{}, err
+	}
+
+	apiKey := ApiKey{
+		Id:      generateApiKeyId(),
+		Name:    name,
+		Key:     utils.ToURLBase64(utils.GenerateRandom(32)),
+		Created: time.Now().UTC().Truncate(time.Second),
+		Expires: expires,
+	}
+	var expiresText interface{}
+	if expires != nil {
+		expiresText = formatDateTime(*expires)
+	}
+	_, err := db.Exec(fmt.Sprintf(
+		"INSERT INTO %s (%s, %s, %s, %s, %s, %s) VALUES (?, ?, ?, ?, ?, ?)",
+		TableApiKeys, ColumnId.name, ColumnUserId.name, ColumnName.name,
+		ColumnKeyHash.name, ColumnCreated.name, ColumnExpires.name),
+		apiKey.Id, userId, apiKey.Name, hashApiKey(apiKey.Key),
+		formatDateTime(apiKey.Created), expiresText)
+	if err != nil {
+		return ApiKey{}, err
+	}
+	return apiKey, nil
+}
+
+// CreateApiKey adds a key to the user, expires is optional
+func (usersDB *UsersDB) CreateApiKey(userId, name string, expires *time.Time) (ApiKey, error) {
+	usersDB.rwLock.Lock()
+	defer usersDB.rwLock.Unlock()
+	return usersDB.createApiKey(usersDB.db, userId, name, expires)
+}
+
+// CreateLoginApiKey adds a key for a new login, earlier logins stay valid.
+// Login keys which weren't used for loginApiKeyIdle are pruned and only the
+// maxLoginApiKeys most recently used ones are kept, as logins would otherwise
+// pile up keys which never expire
+func (usersDB *UsersDB) CreateLoginApiKey(userId string) (ApiKey, error) {
+	usersDB.rwLock.Lock()
+	defer usersDB.rwLock.Unlock()
+
+	tx, err := usersDB.db.Begin()
+	if err != nil {
+		return ApiKey{}, err
+	}
+	defer tx.Rollback()
+
+	lastUsed := fmt.Sprintf("COALESCE(%s, %s)", ColumnLastUsed.name, ColumnCreated.name)
+	_, err = tx.Exec(fmt.Sprintf(
+		"DELETE FROM %s WHERE %s = ? AND %s = ? AND %s < ?",
+		TableApiKeys, ColumnUserId.name, ColumnName.name, lastUsed),
+		userId, LoginApiKeyName, formatDateTime(time.Now().Add(-loginApiKeyIdle)))
+	if err != nil {
+		return ApiKey{}, err
+	}
+	_, err = tx.Exec(fmt.Sprintf(
+		"DELETE FROM %[1]s WHERE %[2]s = ? AND %[3]s = ? AND %[4]s NOT IN "+
+			"(SELECT %[4]s FROM %[1]s WHERE %[2]s = ? AND %[3]s = ? ORDER BY %[5]s DESC, %[4]s DESC LIMIT ?)",
+		TableApiKeys, ColumnUserId.name, ColumnName.name, ColumnId.name, lastUsed),
+		userId, LoginApiKeyName, userId, LoginApiKeyName, maxLoginApiKeys-1)
+	if err != nil {
+		return ApiKey{}, err
+	}
+
+	apiKey, err := usersDB.createApiKey(tx, userId, LoginApiKeyName, nil)
+	if err != nil {
+		return ApiKey{}, err
+	}
+	return apiKey, tx.Commit()
+}
+
+// ListApiKeys returns the keys of the user, the oldest first
+func (usersDB *UsersDB) ListApiKeys(userId string) ([]ApiKey, error) {
+	usersDB.rwLock.RLock()
+	defer usersDB.rwLock.RUnlock()
+
+	rows, err := usersDB.db.Query(fmt.Sprintf(
+		"SELECT %s, %s, %s, %s, %s FROM %s WHERE %s = ? ORDER BY %s, %s",
+		ColumnId.name, ColumnName.name, ColumnCreated.name, ColumnLastUsed.name,
+		ColumnExpires.name, TableApiKeys, ColumnUserId.name,
+		ColumnCreated.name, ColumnId.name), userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	apiKeys := make([]ApiKey, 0)
+	for rows.Next() {
+		var apiKey ApiKey
+		var created, lastUsed, expires nullTime
+		err := rows.Scan(&apiKey.Id, &apiKey.Name, &created, &lastUsed, &expires)
+		if err != nil {
+			return nil, err
+		}
+		if created.time != nil {
+			apiKey.Created = *created.time
+		}
+		apiKey.LastUsed = lastUsed.time
+		apiKey.Expires = expires.time
+		apiKeys = append(apiKeys, apiKey)
+	}
+	return apiKeys, rows.Err()
+}
+
+// UpdateApiKey renames the key of the user and sets its expiry,
+// it returns sql.ErrNoRows if the user has no such key
+func (usersDB *UsersDB) UpdateApiKey(userId string, apiKey ApiKey) error {
+	if err := validateApiKey(apiKey.Name, apiKey.Expires); err != nil {
+		return err
+	}
+
+	usersDB.rwLock.Lock()
+	defer usersDB.rwLock.Unlock()
+
+	var expires interface{}
+	if apiKey.Expires != nil {
+		expires = formatDateTime(*apiKey.Expires)
+	}
+	result, err := usersDB.db.Exec(fmt.Sprintf(
+		"UPDATE %s SET %s = ?, %s = ? WHERE %s = ? AND %s = ?",
+		TableApiKeys, ColumnName.name, ColumnExpires.name,
+		ColumnId.name, ColumnUserId.name),
+		apiKey.Name, expires, apiKey.Id, userId)
+	return affectedRow(result, err)
+}
+
+// RevokeApiKey deletes the key of the user,
+// it returns sql.ErrNoRows if the user has no such key
+func (usersDB *UsersDB) RevokeApiKey(userId, id string) error {
+	usersDB.rwLock.Lock()
+	defer usersDB.rwLock.Unlock()
+
+	result, err := usersDB.db.Exec(fmt.Sprintf(
+		"DELETE FROM %s WHERE %s = ? AND %s = ?",
+		TableApiKeys, ColumnId.name, ColumnUserId.name), id, userId)
+	return affectedRow(result, err)
+}
+
+func affectedRow(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// FindUserByApiKey returns the owner of a key which hasn't expired,
+// ApiKey of the user is the given key
+func (usersDB *UsersDB) FindUserByApiKey(apiKey string) (User, error) {
+	now := time.Now()
+
+	usersDB.rwLock.RLock()
+	var id, userId string
+	var lastUsed nullTime
+	err := usersDB.db.QueryRow(fmt.Sprintf(
+		"SELECT %s, %s, %s FROM %s WHERE %s = ? AND (%s IS NULL OR %s > ?)",
+		ColumnId.name, ColumnUserId.name, ColumnLastUsed.name, TableApiKeys,
+		ColumnKeyHash.name, ColumnExpires.name, ColumnExpires.name),
+		hashApiKey(apiKey), formatDateTime(now)).Scan(&id, &userId, &lastUsed)
+	var user User
+	if err == nil {
+		user, err = usersDB.findUserById(userId)
+	}
+	usersDB.rwLock.RUnlock()
+	if err != nil {
+		return User{}, err
+	}
+
+	if lastUsed.time == nil || now.Sub(*lastUsed.time) >= lastUsedPrecision {
+		usersDB.rwLock.Lock()
+		_, err := usersDB.db.Exec(fmt.Sprintf("UPDATE %s SET %s = ? WHERE %s = ?",
+			TableApiKeys, ColumnLastUsed.name, ColumnId.name), formatDateTime(now), id)
+		usersDB.rwLock.Unlock()
+		if err != nil {
+			return User{}, err
+		}
+	}
+
+	user.ApiKey = apiKey
+	return user, nil
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Grarak/GoYTFetcher/utils"
+)
+
+func newTestUsersDB(t *testing.T) *UsersDB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection would get its own in-memory database
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	usersDB, err := newUsersDB(db, &sync.RWMutex{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return usersDB
+}
+
+func TestCreateLoginApiKey(t *testing.T) {
+	usersDB := newTestUsersDB(t)
+	user, code := usersDB.AddUser(User{Name: "alice", Password: utils.Encode("password")})
+	if code != utils.StatusNoError {
+		t.Fatal(code)
+	}
+
+	var logins []ApiKey
+	for i := 0; i < 3; i++ {
+		apiKey, err := usersDB.CreateLoginApiKey(user.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logins = append(logins, apiKey)
+	}
+	for i, apiKey := range logins {
+		if _, err := usersDB.FindUserByApiKey(apiKey.Key); err != nil {
+			t.Errorf("login %d was signed out by a later login %s", i, err)
+		}
+	}
+
+	// The first login wasn't used for long, it's pruned by the next one
+	_, err := usersDB.db.Exec(fmt.Sprintf("UPDATE %s SET %s = ?, %s = ? WHERE %s = ?",
+		TableApiKeys, ColumnCreated.name, ColumnLastUsed.name, ColumnId.name),
+		formatDateTime(time.Now().Add(-loginApiKeyIdle-time.Hour)), nil, logins[0].Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := usersDB.CreateLoginApiKey(user.Id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := usersDB.FindUserByApiKey(logins[0].Key); err != sql.ErrNoRows {
+		t.Errorf("idle login key wasn't pruned %v", err)
+	}
+	if _, err := usersDB.FindUserByApiKey(logins[1].Key); err != nil {
+		t.Errorf("used login key was pruned %s", err)
+	}
+
+	for i := 0; i < maxLoginApiKeys*2; i++ {
+		if _, err := usersDB.CreateLoginApiKey(user.Id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	apiKeys, err := usersDB.ListApiKeys(user.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for _, apiKey := range apiKeys {
+		if apiKey.Name == LoginApiKeyName {
+			count++
+		} else if apiKey.Name != SignupApiKeyName {
+			t.Errorf("unexpected key %s", apiKey.Name)
+		}
+	}
+	if count != maxLoginApiKeys {
+		t.Errorf("%d login keys, want %d", count, maxLoginApiKeys)
+	}
+	if len(apiKeys) != maxLoginApiKeys+1 {
+		t.Errorf("signup key was pruned, %d keys left", len(apiKeys))
+	}
+}
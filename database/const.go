@@ -38,5 +38,11 @@ var ColumnId = column{"id", text()}
 var ColumnIds = column{"ids", text()}
 var ColumnDate = column{"date", datetime()}
 
-var ForeignKeyApikey = foreignKey{ColumnApikey.name, text(), TableUsers,
-	ColumnApikey.name, true}
+var ColumnUserId = column{"user_id", text()}
+var ColumnKeyHash = column{"key_hash", text()}
+var ColumnCreated = column{"created", datetime()}
+var ColumnLastUsed = column{"last_used", datetime()}
+var ColumnExpires = column{"expires", datetime()}
+
+var ForeignKeyUserId = foreignKey{ColumnUserId.name, text(), TableUsers,
+	ColumnUserId.name, true}
@@ -12,7 +12,8 @@ var singletonLock sync.Mutex
 var databaseInstance *Database
 
 type Database struct {
-	db *sql.DB
+	db     *sql.DB
+	rwLock *sync.RWMutex
 
 	UsersDB     *UsersDB
 	PlaylistsDB *PlaylistsDB
@@ -39,6 +40,9 @@ func GetDatabase(key []byte, ytKey string) *Database {
 	_, err = db.Exec("PRAGMA foreign_keys = ON")
 	utils.Panic(err)
 
+	utils.Panic(migrateUserIds(db))
+	utils.Panic(migrateHealthCheck(db))
+
 	rwLock := &sync.RWMutex{}
 
 	usersDB, err := newUsersDB(db, rwLock)
@@ -50,11 +54,15 @@ func GetDatabase(key []byte, ytKey string) *Database {
 	historiesDB, err := newHistoriesDB(db, rwLock)
 	utils.Panic(err)
 
+	_, err = db.Exec(healthCheckTable())
+	utils.Panic(err)
+
 	youtubeDB, err := newYoutubeDB(key, ytKey)
 	utils.Panic(err)
 
 	databaseInstance = &Database{
 		db,
+		rwLock,
 		usersDB,
 		playlistsDB,
 		historiesDB,
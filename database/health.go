@@ -0,0 +1,62 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// TableHealthCheck holds the single row CheckWritable overwrites
+const TableHealthCheck = "healthcheck"
+
+func healthCheckTable() string {
+	return newTableBuilder(TableHealthCheck).
+		addPrimaryKey(ColumnId).
+		addColumn(ColumnDate).build()
+}
+
+// CheckWritable writes to the database, which fails
+// when the disk is full or the file turned read only
+func (database *Database) CheckWritable(ctx context.Context) error {
+	database.rwLock.Lock()
+	defer database.rwLock.Unlock()
+
+	tx, err := database.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(
+		"INSERT OR REPLACE INTO %s (%s, %s) VALUES (?, ?)",
+		TableHealthCheck, ColumnId.name, ColumnDate.name),
+		"last", formatDateTime(time.Now()))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CheckLastExtraction fails if the last attempt to extract a song didn't work
+func (database *Database) CheckLastExtraction(ctx context.Context) error {
+	attempt, err := database.YoutubeDB.LastExtraction()
+	if err != nil {
+		return fmt.Errorf("extraction at %s failed %s", attempt.Format(time.RFC3339), err)
+	}
+	return nil
+}
+
+func (youtubeDB *youtubeDBImpl) recordExtraction(err error) {
+	youtubeDB.extractionLock.Lock()
+	defer youtubeDB.extractionLock.Unlock()
+	youtubeDB.lastExtraction = time.Now()
+	youtubeDB.lastExtractionErr = err
+}
+
+// LastExtraction returns when a song was extracted the last time and whether
+// it failed, the time is zero if nothing was extracted yet
+func (youtubeDB *youtubeDBImpl) LastExtraction() (time.Time, error) {
+	youtubeDB.extractionLock.RLock()
+	defer youtubeDB.extractionLock.RUnlock()
+	return youtubeDB.lastExtraction, youtubeDB.lastExtractionErr
+}
@@ -12,7 +12,7 @@ import (
 const TableHistories = "histories"
 
 type History struct {
-	ApiKey string    `json:"apikey"`
+	UserId string    `json:"-"`
 	Id     string    `json:"id"`
 	Date   time.Time `json:"-"`
 }
@@ -28,13 +28,15 @@ type HistoriesDB struct {
 	rwLock *sync.RWMutex
 }
 
-func newHistoriesDB(db *sql.DB, rwLock *sync.RWMutex) (*HistoriesDB, error) {
-	cmd := newTableBuilder(TableHistories).
-		addForeignKey(ForeignKeyApikey).
+func historiesTable() string {
+	return newTableBuilder(TableHistories).
+		addForeignKey(ForeignKeyUserId).
 		addPrimaryKey(ColumnId).
 		addColumn(ColumnDate).build()
+}
 
-	_, err := db.Exec(cmd)
+func newHistoriesDB(db *sql.DB, rwLock *sync.RWMutex) (*HistoriesDB, error) {
+	_, err := db.Exec(historiesTable())
 	if err != nil {
 		return nil, err
 	}
@@ -42,19 +44,19 @@ func newHistoriesDB(db *sql.DB, rwLock *sync.RWMutex) (*HistoriesDB, error) {
 	return &HistoriesDB{db, rwLock}, nil
 }
 
-func (historiesDB *HistoriesDB) AddHistory(apiKey, id string) error {
+func (historiesDB *HistoriesDB) AddHistory(userId, id string) error {
 	id = strings.TrimSpace(id)
 	historiesDB.rwLock.Lock()
 	defer historiesDB.rwLock.Unlock()
 
-	history, err := historiesDB.getHistory(apiKey)
+	history, err := historiesDB.getHistory(userId)
 	if err != nil {
 		return err
 	}
 	for i := 50; i < len(history); i++ {
 		_, err := historiesDB.db.Exec(fmt.Sprintf(
 			"DELETE FROM %s WHERE %s = ? AND %s = ?",
-			TableHistories, ColumnApikey.name, ColumnId.name), apiKey, history[i])
+			TableHistories, ColumnUserId.name, ColumnId.name), userId, history[i])
 		if err != nil {
 			return err
 		}
@@ -62,30 +64,92 @@ func (historiesDB *HistoriesDB) AddHistory(apiKey, id string) error {
 
 	_, err = historiesDB.db.Exec(fmt.Sprintf(
 		"INSERT OR REPLACE INTO %s (%s, %s, %s) VALUES (?, ?, ?)",
-		TableHistories, ColumnApikey.name, ColumnId.name,
+		TableHistories, ColumnUserId.name, ColumnId.name,
 		ColumnDate.name),
-		apiKey, id, time.Now().Format(dateTimeFormat))
+		userId, id, time.Now().Format(dateTimeFormat))
 	return err
 }
 
-func (historiesDB *HistoriesDB) GetHistory(apiKey string) ([]string, error) {
+func (historiesDB *HistoriesDB) GetHistory(userId string) ([]string, error) {
+	historiesDB.rwLock.RLock()
+	defer historiesDB.rwLock.RUnlock()
+	return historiesDB.getHistory(userId)
+}
+
+// ListHistory returns a page of the history, latest first
+func (historiesDB *HistoriesDB) ListHistory(userId string, request PageRequest) (IdsPage, error) {
 	historiesDB.rwLock.RLock()
 	defer historiesDB.rwLock.RUnlock()
-	return historiesDB.getHistory(apiKey)
+
+	const query = "history"
+	after, err := request.after(query)
+	if err != nil {
+		return IdsPage{}, err
+	}
+
+	var total int
+	err = historiesDB.db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s = ?",
+		TableHistories, ColumnUserId.name), userId).Scan(&total)
+	if err != nil {
+		return IdsPage{}, err
+	}
+
+	where := fmt.Sprintf("WHERE %s = ?", ColumnUserId.name)
+	args := []interface{}{userId}
+	if after != nil {
+		// Songs played in the same second are ordered by their id
+		where += fmt.Sprintf(" AND (%[1]s < ? OR (%[1]s = ? AND %[2]s < ?))",
+			ColumnDate.name, ColumnId.name)
+		args = append(args, after.Date, after.Date, after.Id)
+	}
+	rows, err := historiesDB.db.Query(fmt.Sprintf(
+		"SELECT %s, %s FROM %s %s ORDER BY %s DESC, %s DESC LIMIT ? OFFSET ?",
+		ColumnId.name, ColumnDate.name, TableHistories, where,
+		ColumnDate.name, ColumnId.name),
+		append(args, request.size()+1, request.offset())...)
+	if err != nil {
+		return IdsPage{}, err
+	}
+	defer rows.Close()
+
+	page := IdsPage{Items: make([]string, 0)}
+	var last cursor
+	more := false
+	for rows.Next() {
+		if len(page.Items) == request.size() {
+			more = true
+			break
+		}
+		var id string
+		var date nullTime
+		if err := rows.Scan(&id, &date); err != nil {
+			return IdsPage{}, err
+		}
+		page.Items = append(page.Items, id)
+		last = cursor{Query: query, Id: id}
+		if date.time != nil {
+			last.Date = formatDateTime(*date.time)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return IdsPage{}, err
+	}
+	page.PageInfo = newPageInfo(last, more, total)
+	return page, nil
 }
 
-func (historiesDB *HistoriesDB) getHistory(apiKey string) ([]string, error) {
+func (historiesDB *HistoriesDB) getHistory(userId string) ([]string, error) {
 	stmt, err := historiesDB.db.Prepare(fmt.Sprintf(
 		"SELECT %s FROM %s WHERE %s = ? "+
 			"ORDER BY %s DESC",
-		ColumnId.name, TableHistories, ColumnApikey.name,
+		ColumnId.name, TableHistories, ColumnUserId.name,
 		ColumnDate.name))
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 
-	rows, err := stmt.Query(apiKey)
+	rows, err := stmt.Query(userId)
 	if err != nil {
 		return nil, err
 	}
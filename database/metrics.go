@@ -0,0 +1,51 @@
+package database
+
+import (
+	"io/ioutil"
+
+	"github.com/Grarak/GoYTFetcher/metrics"
+	"github.com/Grarak/GoYTFetcher/utils"
+)
+
+var (
+	cacheEntries = metrics.NewGauge("ytfetcher_cache_entries",
+		"Number of entries in the in-memory caches", "cache")
+	cacheLookups = metrics.NewCounter("ytfetcher_cache_lookups_total",
+		"Cache lookups of fetch, search and getinfo by result", "cache", "result")
+	activeDownloads = metrics.NewGauge("ytfetcher_downloads_active",
+		"youtube-dl downloads currently running")
+	finishedDownloads = metrics.NewCounter("ytfetcher_downloads_total",
+		"Finished youtube-dl downloads by state", "state")
+	searchBackends = metrics.NewCounter("ytfetcher_search_backend_total",
+		"Searches by the backend which answered them", "backend")
+	diskUsage = metrics.NewGauge("ytfetcher_youtube_dir_bytes",
+		"Size of the downloaded songs in "+utils.YOUTUBE_DIR)
+	diskFiles = metrics.NewGauge("ytfetcher_youtube_dir_files",
+		"Number of files in "+utils.YOUTUBE_DIR)
+)
+
+func (youtubeDB *youtubeDBImpl) registerMetrics() {
+	metrics.OnScrape(func() {
+		cacheEntries.Set(float64(youtubeDB.songsRanking.getSize()), "songs")
+		cacheEntries.Set(float64(youtubeDB.searchesRanking.getSize()), "searches")
+		cacheEntries.Set(float64(youtubeDB.idRanking.getSize()), "ids")
+
+		files, err := ioutil.ReadDir(utils.YOUTUBE_DIR)
+		if err != nil {
+			return
+		}
+		var size int64
+		for _, file := range files {
+			size += file.Size()
+		}
+		diskUsage.Set(float64(size))
+		diskFiles.Set(float64(len(files)))
+	})
+}
+
+func cacheResult(hit bool) string {
+	if hit {
+		return "hit"
+	}
+	return "miss"
+}
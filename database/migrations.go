@@ -0,0 +1,157 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// tableColumns returns the column names of table, none if it doesn't exist
+func tableColumns(db *sql.DB, table string) (map[string]bool, error) {
+	rows, err := db.Query("PRAGMA table_info(" + table + ")")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := make(map[string]bool)
+	for rows.Next() {
+		var cid, notNull, primaryKey int
+		var name, dataType string
+		var defaultValue sql.NullString
+		err := rows.Scan(&cid, &name, &dataType, &notNull, &defaultValue, &primaryKey)
+		if err != nil {
+			return nil, err
+		}
+		names[name] = true
+	}
+	return names, rows.Err()
+}
+
+// migrateUserIds converts databases from when playlists and histories
+// referenced the single apikey of their user. Users get a stable id
+// instead and their apikey becomes a key named SignupApiKeyName
+func migrateUserIds(db *sql.DB) error {
+	columns, err := tableColumns(db, TableUsers)
+	if err != nil || !columns[ColumnApikey.name] {
+		return err
+	}
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Foreign keys can't be checked while the tables are swapped
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	tables := []string{TableUsers, TablePlaylists, TableHistories}
+	for _, table := range tables {
+		cmd := fmt.Sprintf("ALTER TABLE %s RENAME TO %s_old", table, table)
+		if _, err := tx.Exec(cmd); err != nil {
+			return err
+		}
+	}
+	for _, cmd := range []string{usersTable(), apiKeysTable(), playlistsTable(), historiesTable()} {
+		if _, err := tx.Exec(cmd); err != nil {
+			return err
+		}
+	}
+
+	type oldUser struct {
+		apiKey, name, salt, hash string
+		admin, verified          bool
+	}
+	rows, err := tx.Query(fmt.Sprintf(
+		"SELECT %s, %s, %s, %s, IFNULL(%s, 0), IFNULL(%s, 0) FROM %s_old",
+		ColumnApikey.name, ColumnName.name, ColumnPasswordSalt.name,
+		ColumnPasswordHash.name, ColumnAdmin.name, ColumnVerified.name, TableUsers))
+	if err != nil {
+		return err
+	}
+	var users []oldUser
+	for rows.Next() {
+		var user oldUser
+		err := rows.Scan(&user.apiKey, &user.name, &user.salt, &user.hash,
+			&user.admin, &user.verified)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		users = append(users, user)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	created := formatDateTime(time.Now())
+	for _, user := range users {
+		userId := generateUserId()
+		_, err := tx.Exec(fmt.Sprintf(
+			"INSERT INTO %s (%s, %s, %s, %s, %s, %s) VALUES (?, ?, ?, ?, ?, ?)",
+			TableUsers, ColumnUserId.name, ColumnName.name, ColumnPasswordSalt.name,
+			ColumnPasswordHash.name, ColumnAdmin.name, ColumnVerified.name),
+			userId, user.name, user.salt, user.hash, user.admin, user.verified)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(fmt.Sprintf(
+			"INSERT INTO %s (%s, %s, %s, %s, %s) VALUES (?, ?, ?, ?, ?)",
+			TableApiKeys, ColumnId.name, ColumnUserId.name, ColumnName.name,
+			ColumnKeyHash.name, ColumnCreated.name),
+			generateApiKeyId(), userId, SignupApiKeyName, hashApiKey(user.apiKey), created)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The old rows are matched to the new users by their unique name
+	owner := fmt.Sprintf("(SELECT %s FROM %s WHERE %s = "+
+		"(SELECT %s FROM %s_old WHERE %s = old.%s))",
+		ColumnUserId.name, TableUsers, ColumnName.name,
+		ColumnName.name, TableUsers, ColumnApikey.name, ColumnApikey.name)
+	copies := []string{
+		fmt.Sprintf("INSERT INTO %s (%s, %s, %s, %s) SELECT %s, %s, %s, %s FROM %s_old old",
+			TablePlaylists, ColumnUserId.name, ColumnName.name, ColumnPublic.name, ColumnIds.name,
+			owner, ColumnName.name, ColumnPublic.name, ColumnIds.name, TablePlaylists),
+		fmt.Sprintf("INSERT INTO %s (%s, %s, %s) SELECT %s, %s, %s FROM %s_old old",
+			TableHistories, ColumnUserId.name, ColumnId.name, ColumnDate.name,
+			owner, ColumnId.name, ColumnDate.name, TableHistories),
+	}
+	for _, cmd := range copies {
+		if _, err := tx.Exec(cmd + " WHERE " + owner + " IS NOT NULL"); err != nil {
+			return err
+		}
+	}
+
+	for i := len(tables) - 1; i >= 0; i-- {
+		if _, err := tx.Exec("DROP TABLE " + tables[i] + "_old"); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// migrateHealthCheck drops the table earlier health checks created
+// on the fly, it's recreated with the other tables
+func migrateHealthCheck(db *sql.DB) error {
+	columns, err := tableColumns(db, TableHealthCheck)
+	if err != nil || len(columns) == 0 || columns[ColumnId.name] {
+		return err
+	}
+	_, err = db.Exec("DROP TABLE " + TableHealthCheck)
+	return err
+}
@@ -0,0 +1,174 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/Grarak/GoYTFetcher/utils"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// Sort orders of the lists which can be sorted
+const (
+	SortNameAsc  = "name"
+	SortNameDesc = "-name"
+)
+
+// ErrInvalidCursor is returned for cursors which weren't created by the same list query
+var ErrInvalidCursor = errors.New("invalid cursor")
+var ErrInvalidSort = errors.New("invalid sort order")
+
+// PageRequest selects a page, Cursor is the Next of the previous page.
+// Offset is only used without Cursor, v1 still counts pages
+type PageRequest struct {
+	Cursor string
+	Offset int
+	Size   int
+}
+
+// PageInfo is embedded by the pages, Next is empty on the last page
+type PageInfo struct {
+	Next  string `json:"next,omitempty"`
+	Total int    `json:"total"`
+}
+
+type UsersPage struct {
+	Items []User `json:"items"`
+	PageInfo
+}
+
+type PlaylistsPage struct {
+	Items []Playlist `json:"items"`
+	PageInfo
+}
+
+type IdsPage struct {
+	Items []string `json:"items"`
+	PageInfo
+}
+
+// cursor is opaque to clients, it only continues the query it was created for.
+// It holds the sort keys of the last item of the previous page, so pages don't
+// shift when items are added or removed in between
+type cursor struct {
+	Query string `json:"q"`
+	Name  string `json:"n,omitempty"`
+	Date  string `json:"d,omitempty"`
+	Id    string `json:"i,omitempty"`
+	Index int    `json:"x,omitempty"`
+}
+
+func (request PageRequest) size() int {
+	switch {
+	case request.Size <= 0:
+		return DefaultPageSize
+	case request.Size > MaxPageSize:
+		return MaxPageSize
+	}
+	return request.Size
+}
+
+// offset is only used by requests without cursor
+func (request PageRequest) offset() int {
+	if !utils.StringIsEmpty(request.Cursor) || request.Offset < 0 {
+		return 0
+	}
+	return request.Offset
+}
+
+// after decodes the cursor, nil means the page starts at the beginning.
+// query identifies filters and sorting
+func (request PageRequest) after(query string) (*cursor, error) {
+	if utils.StringIsEmpty(request.Cursor) {
+		return nil, nil
+	}
+
+	data, err := utils.FromURLBase64(request.Cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var decoded cursor
+	if err := json.Unmarshal(data, &decoded); err != nil ||
+		decoded.Query != query || decoded.Index < 0 {
+		return nil, ErrInvalidCursor
+	}
+	return &decoded, nil
+}
+
+// newPageInfo creates the cursor of the next page from last, the last item
+// of this page. Lists fetch one item more than the page size to know if
+// there is a next page at all
+func newPageInfo(last cursor, more bool, total int) PageInfo {
+	info := PageInfo{Total: total}
+	if more {
+		data, err := json.Marshal(last)
+		utils.Panic(err)
+		info.Next = utils.ToURLBase64(data)
+	}
+	return info
+}
+
+// sortName validates sort and returns the matching ORDER BY clause,
+// names which only differ in case are ordered by their bytes
+func sortName(sort string) (string, error) {
+	switch sort {
+	case "", SortNameAsc:
+		return fmt.Sprintf(" ORDER BY %[1]s COLLATE NOCASE ASC, %[1]s ASC", ColumnName.name), nil
+	case SortNameDesc:
+		return fmt.Sprintf(" ORDER BY %[1]s COLLATE NOCASE DESC, %[1]s DESC", ColumnName.name), nil
+	}
+	return "", ErrInvalidSort
+}
+
+// afterName continues a list ordered by sortName behind name
+func afterName(sort, name string) (string, []interface{}) {
+	compare := ">"
+	if sort == SortNameDesc {
+		compare = "<"
+	}
+	return fmt.Sprintf(" AND (%[1]s COLLATE NOCASE %[2]s ? OR (%[1]s COLLATE NOCASE = ? AND %[1]s %[2]s ?))",
+		ColumnName.name, compare), []interface{}{name, name, name}
+}
+
+// pageIds slices ids in memory, they are stored as a single column.
+// The cursor keeps the last id and its index, if the id moved since,
+// the page continues behind its first occurrence
+func pageIds(ids []string, query string, request PageRequest) (IdsPage, error) {
+	after, err := request.after(query)
+	if err != nil {
+		return IdsPage{}, err
+	}
+	start := request.offset()
+	if after != nil {
+		start = -1
+		if after.Index < len(ids) && ids[after.Index] == after.Id {
+			start = after.Index + 1
+		} else if index := utils.StringArrayIndex(ids, after.Id); index >= 0 {
+			start = index + 1
+		}
+		if start < 0 {
+			return IdsPage{}, ErrInvalidCursor
+		}
+	}
+
+	page := IdsPage{Items: make([]string, 0)}
+	end := start
+	if start < len(ids) {
+		end = start + request.size()
+		if end > len(ids) {
+			end = len(ids)
+		}
+		page.Items = ids[start:end]
+	}
+	var last cursor
+	if len(page.Items) > 0 {
+		last = cursor{Query: query, Id: ids[end-1], Index: end - 1}
+	}
+	page.PageInfo = newPageInfo(last, len(page.Items) > 0 && end < len(ids), len(ids))
+	return page, nil
+}
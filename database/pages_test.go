@@ -0,0 +1,121 @@
+package database
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/Grarak/GoYTFetcher/utils"
+)
+
+func encodeCursor(t *testing.T, value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return utils.ToURLBase64(data)
+}
+
+func TestPageRequestCursor(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor string
+		after  *cursor
+		err    error
+	}{
+		{"first page", "", nil, nil},
+		{"name", encodeCursor(t, cursor{Query: "users", Name: "alice"}),
+			&cursor{Query: "users", Name: "alice"}, nil},
+		{"date and id", encodeCursor(t, cursor{Query: "users", Date: "2020-01-01 00:00:00", Id: "x"}),
+			&cursor{Query: "users", Date: "2020-01-01 00:00:00", Id: "x"}, nil},
+		{"other query", encodeCursor(t, cursor{Query: "playlists", Name: "alice"}), nil, ErrInvalidCursor},
+		{"negative index", encodeCursor(t, cursor{Query: "users", Index: -1}), nil, ErrInvalidCursor},
+		{"not base64", "%%%", nil, ErrInvalidCursor},
+		{"not json", utils.ToURLBase64([]byte("users")), nil, ErrInvalidCursor},
+		{"wrong types", encodeCursor(t, map[string]int{"q": 1}), nil, ErrInvalidCursor},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			after, err := PageRequest{Cursor: test.cursor}.after("users")
+			if err != test.err || !reflect.DeepEqual(after, test.after) {
+				t.Errorf("after = %+v, %v, want %+v, %v", after, err, test.after, test.err)
+			}
+		})
+	}
+}
+
+func TestPageRequestSize(t *testing.T) {
+	tests := []struct {
+		request PageRequest
+		size    int
+		offset  int
+	}{
+		{PageRequest{}, DefaultPageSize, 0},
+		{PageRequest{Size: -1, Offset: -10}, DefaultPageSize, 0},
+		{PageRequest{Size: 5, Offset: 10}, 5, 10},
+		{PageRequest{Size: MaxPageSize + 1}, MaxPageSize, 0},
+		// v1 pages are never combined with cursors
+		{PageRequest{Cursor: "x", Offset: 10}, DefaultPageSize, 0},
+	}
+	for _, test := range tests {
+		if size, offset := test.request.size(), test.request.offset(); size != test.size || offset != test.offset {
+			t.Errorf("%+v: size %d offset %d, want %d %d", test.request, size, offset, test.size, test.offset)
+		}
+	}
+}
+
+func TestSortName(t *testing.T) {
+	for _, sort := range []string{"", SortNameAsc, SortNameDesc} {
+		if _, err := sortName(sort); err != nil {
+			t.Errorf("sortName(%q) failed %s", sort, err)
+		}
+	}
+	for _, sort := range []string{"date", "-", "name; DROP TABLE users"} {
+		if _, err := sortName(sort); err != ErrInvalidSort {
+			t.Errorf("sortName(%q) = %v, want ErrInvalidSort", sort, err)
+		}
+	}
+}
+
+func TestPageIds(t *testing.T) {
+	ids := []string{"a", "b", "c", "d", "e"}
+
+	first, err := pageIds(ids, "ids", PageRequest{Size: 2})
+	if err != nil || !reflect.DeepEqual(first.Items, []string{"a", "b"}) || first.Total != 5 {
+		t.Fatalf("first page %+v, %v", first, err)
+	}
+
+	tests := []struct {
+		name  string
+		ids   []string
+		query string
+		items []string
+		err   error
+	}{
+		{"unchanged", ids, "ids", []string{"c", "d"}, nil},
+		{"inserted before", []string{"x", "a", "b", "c", "d"}, "ids", []string{"c", "d"}, nil},
+		{"removed before", []string{"b", "c", "d"}, "ids", []string{"c", "d"}, nil},
+		{"last id removed", []string{"a", "c", "d"}, "ids", nil, ErrInvalidCursor},
+		{"other list", ids, "other", nil, ErrInvalidCursor},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			page, err := pageIds(test.ids, test.query, PageRequest{Size: 2, Cursor: first.Next})
+			if err != test.err {
+				t.Fatalf("err %v, want %v", err, test.err)
+			}
+			if err == nil && !reflect.DeepEqual(page.Items, test.items) {
+				t.Errorf("items %v, want %v", page.Items, test.items)
+			}
+		})
+	}
+
+	last, err := pageIds(ids, "ids", PageRequest{Size: 5})
+	if err != nil || last.Next != "" {
+		t.Errorf("complete page has next %q, %v", last.Next, err)
+	}
+	empty, err := pageIds([]string{}, "ids", PageRequest{})
+	if err != nil || len(empty.Items) != 0 || empty.Next != "" {
+		t.Errorf("empty page %+v, %v", empty, err)
+	}
+}
@@ -3,7 +3,9 @@ package database
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -12,26 +14,28 @@ import (
 
 const TablePlaylists = "playlists"
 
+var ErrIdNotFound = errors.New("id to delete not found")
+var ErrDuplicateIds = errors.New("duplicate in ids")
+
 type Playlist struct {
-	ApiKey string `json:"apikey,omitempty"`
+	UserId string `json:"-"`
 	Name   string `json:"name"`
 	Public bool   `json:"public"`
 }
 
 type PlaylistId struct {
-	ApiKey string `json:"apikey,omitempty"`
+	UserId string `json:"-"`
 	Name   string `json:"name"`
 	Id     string `json:"id"`
 }
 
 type PlaylistIds struct {
-	ApiKey string   `json:"apikey,omitempty"`
+	UserId string   `json:"-"`
 	Name   string   `json:"name"`
 	Ids    []string `json:"ids"`
 }
 
 type PlaylistLinkPublic struct {
-	ApiKey   string `json:"apikey,omitempty"`
 	Name     string `json:"name"`
 	Playlist string `json:"playlist"`
 }
@@ -65,14 +69,16 @@ type PlaylistsDB struct {
 	rwLock *sync.RWMutex
 }
 
-func newPlaylistsDB(db *sql.DB, rwLock *sync.RWMutex) (*PlaylistsDB, error) {
-	cmd := newTableBuilder(TablePlaylists).
-		addForeignKey(ForeignKeyApikey).
+func playlistsTable() string {
+	return newTableBuilder(TablePlaylists).
+		addForeignKey(ForeignKeyUserId).
 		addPrimaryKey(ColumnName).
 		addColumn(ColumnPublic).
 		addColumn(ColumnIds).build()
+}
 
-	_, err := db.Exec(cmd)
+func newPlaylistsDB(db *sql.DB, rwLock *sync.RWMutex) (*PlaylistsDB, error) {
+	_, err := db.Exec(playlistsTable())
 	if err != nil {
 		return nil, err
 	}
@@ -80,14 +86,14 @@ func newPlaylistsDB(db *sql.DB, rwLock *sync.RWMutex) (*PlaylistsDB, error) {
 	return &PlaylistsDB{db, rwLock}, nil
 }
 
-func (playlistsDB *PlaylistsDB) GetPlaylists(apiKey string, publicOnly bool) ([]Playlist, error) {
+func (playlistsDB *PlaylistsDB) GetPlaylists(userId string, publicOnly bool) ([]Playlist, error) {
 	playlistsDB.rwLock.RLock()
 	defer playlistsDB.rwLock.RUnlock()
 
 	cmd := fmt.Sprintf(
 		"SELECT %s,%s FROM %s WHERE %s = ?",
 		ColumnName.name, ColumnPublic.name, TablePlaylists,
-		ColumnApikey.name)
+		ColumnUserId.name)
 	if publicOnly {
 		cmd += fmt.Sprintf(" AND %s = 1", ColumnPublic.name)
 	}
@@ -98,7 +104,7 @@ func (playlistsDB *PlaylistsDB) GetPlaylists(apiKey string, publicOnly bool) ([]
 	}
 	defer stmt.Close()
 
-	rows, err := stmt.Query(apiKey)
+	rows, err := stmt.Query(userId)
 	if err != nil {
 		return nil, err
 	}
@@ -119,6 +125,101 @@ func (playlistsDB *PlaylistsDB) GetPlaylists(apiKey string, publicOnly bool) ([]
 	return playlists, nil
 }
 
+// PlaylistFilter narrows ListPlaylists down, Name matches parts of the playlist names
+type PlaylistFilter struct {
+	Name       string
+	PublicOnly bool
+	Sort       string
+}
+
+func (filter PlaylistFilter) query() string {
+	return "playlists," + filter.Name + "," + strconv.FormatBool(filter.PublicOnly) + "," + filter.Sort
+}
+
+func (playlistsDB *PlaylistsDB) ListPlaylists(userId string, filter PlaylistFilter, request PageRequest) (PlaylistsPage, error) {
+	playlistsDB.rwLock.RLock()
+	defer playlistsDB.rwLock.RUnlock()
+
+	order, err := sortName(filter.Sort)
+	if err != nil {
+		return PlaylistsPage{}, err
+	}
+	query := filter.query()
+	after, err := request.after(query)
+	if err != nil {
+		return PlaylistsPage{}, err
+	}
+
+	where := fmt.Sprintf("WHERE %s = ?", ColumnUserId.name)
+	args := []interface{}{userId}
+	if filter.PublicOnly {
+		where += fmt.Sprintf(" AND %s = 1", ColumnPublic.name)
+	}
+	if !utils.StringIsEmpty(filter.Name) {
+		where += fmt.Sprintf(" AND %s LIKE ? ESCAPE '\\'", ColumnName.name)
+		args = append(args, "%"+likeEscaper.Replace(filter.Name)+"%")
+	}
+
+	var total int
+	err = playlistsDB.db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s %s",
+		TablePlaylists, where), args...).Scan(&total)
+	if err != nil {
+		return PlaylistsPage{}, err
+	}
+
+	if after != nil {
+		keyset, keysetArgs := afterName(filter.Sort, after.Name)
+		where += keyset
+		args = append(args, keysetArgs...)
+	}
+	rows, err := playlistsDB.db.Query(fmt.Sprintf("SELECT %s,%s FROM %s %s%s LIMIT ? OFFSET ?",
+		ColumnName.name, ColumnPublic.name, TablePlaylists, where, order),
+		append(args, request.size()+1, request.offset())...)
+	if err != nil {
+		return PlaylistsPage{}, err
+	}
+	defer rows.Close()
+
+	page := PlaylistsPage{Items: make([]Playlist, 0)}
+	for rows.Next() {
+		var playlist Playlist
+		if err := rows.Scan(&playlist.Name, &playlist.Public); err != nil {
+			return PlaylistsPage{}, err
+		}
+		page.Items = append(page.Items, playlist)
+	}
+	if err := rows.Err(); err != nil {
+		return PlaylistsPage{}, err
+	}
+	more := len(page.Items) > request.size()
+	if more {
+		page.Items = page.Items[:request.size()]
+	}
+	var last cursor
+	if len(page.Items) > 0 {
+		last = cursor{Query: query, Name: page.Items[len(page.Items)-1].Name}
+	}
+	page.PageInfo = newPageInfo(last, more, total)
+	return page, nil
+}
+
+// GetPlaylist returns sql.ErrNoRows if the user has no playlist with that name
+func (playlistsDB *PlaylistsDB) GetPlaylist(userId, name string) (Playlist, error) {
+	playlistsDB.rwLock.RLock()
+	defer playlistsDB.rwLock.RUnlock()
+
+	row := playlistsDB.db.QueryRow(fmt.Sprintf(
+		"SELECT %s FROM %s WHERE %s = ? AND %s = ?",
+		ColumnPublic.name, TablePlaylists, ColumnUserId.name, ColumnName.name),
+		userId, name)
+
+	playlist := Playlist{Name: name}
+	if err := row.Scan(&playlist.Public); err != nil {
+		return Playlist{}, err
+	}
+	return playlist, nil
+}
+
 func (playlistsDB *PlaylistsDB) CreatePlaylist(playlist Playlist) error {
 	playlistsDB.rwLock.Lock()
 	defer playlistsDB.rwLock.Unlock()
@@ -126,8 +227,8 @@ func (playlistsDB *PlaylistsDB) CreatePlaylist(playlist Playlist) error {
 	_, err := playlistsDB.db.Exec(fmt.Sprintf(
 		"INSERT INTO %s (%s,%s,%s,%s) VALUES (?,?,?,?)",
 		TablePlaylists,
-		ColumnApikey.name, ColumnName.name, ColumnPublic.name, ColumnIds.name),
-		playlist.ApiKey, playlist.Name, playlist.Public, "")
+		ColumnUserId.name, ColumnName.name, ColumnPublic.name, ColumnIds.name),
+		playlist.UserId, playlist.Name, playlist.Public, "")
 	return err
 }
 
@@ -137,8 +238,8 @@ func (playlistsDB *PlaylistsDB) DeletePlaylist(playlist Playlist) error {
 
 	_, err := playlistsDB.db.Exec(fmt.Sprintf(
 		"DELETE FROM %s WHERE %s = ? AND %s = ?",
-		TablePlaylists, ColumnApikey.name, ColumnName.name),
-		playlist.ApiKey, playlist.Name)
+		TablePlaylists, ColumnUserId.name, ColumnName.name),
+		playlist.UserId, playlist.Name)
 	return err
 }
 
@@ -148,8 +249,8 @@ func (playlistsDB *PlaylistsDB) SetPublic(playlist Playlist) error {
 
 	_, err := playlistsDB.db.Exec(fmt.Sprintf(
 		"UPDATE %s SET %s = ? WHERE %s = ? AND %s = ?",
-		TablePlaylists, ColumnPublic.name, ColumnApikey.name, ColumnName.name),
-		playlist.Public, playlist.ApiKey, playlist.Name)
+		TablePlaylists, ColumnPublic.name, ColumnUserId.name, ColumnName.name),
+		playlist.Public, playlist.UserId, playlist.Name)
 	return err
 }
 
@@ -159,16 +260,28 @@ func (playlistsDB *PlaylistsDB) GetPlaylistIds(playlist Playlist) ([]string, err
 	return playlistsDB.getPlaylistIds(playlist)
 }
 
+// ListPlaylistIds returns a page of the videos of a playlist in their order
+func (playlistsDB *PlaylistsDB) ListPlaylistIds(playlist Playlist, request PageRequest) (IdsPage, error) {
+	playlistsDB.rwLock.RLock()
+	defer playlistsDB.rwLock.RUnlock()
+
+	ids, err := playlistsDB.getPlaylistIds(playlist)
+	if err != nil {
+		return IdsPage{}, err
+	}
+	return pageIds(ids, "playlistids,"+playlist.Name, request)
+}
+
 func (playlistsDB *PlaylistsDB) getPlaylistIds(playlist Playlist) ([]string, error) {
 	stmt, err := playlistsDB.db.Prepare(fmt.Sprintf(
 		"SELECT %s FROM %s WHERE %s = ? AND %s = ?",
-		ColumnIds.name, TablePlaylists, ColumnApikey.name, ColumnName.name))
+		ColumnIds.name, TablePlaylists, ColumnUserId.name, ColumnName.name))
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 
-	row := stmt.QueryRow(playlist.ApiKey, playlist.Name)
+	row := stmt.QueryRow(playlist.UserId, playlist.Name)
 	var ids string
 	err = row.Scan(&ids)
 	if err != nil {
@@ -187,8 +300,8 @@ func (playlistsDB *PlaylistsDB) IsPlaylistPublic(playlist Playlist) bool {
 
 	row := playlistsDB.db.QueryRow(fmt.Sprintf(
 		"SELECT 1 FROM %s WHERE %s = ? AND %s = ? AND %s = ?",
-		TablePlaylists, ColumnApikey.name, ColumnName.name, ColumnPublic.name),
-		playlist.ApiKey, playlist.Name, true)
+		TablePlaylists, ColumnUserId.name, ColumnName.name, ColumnPublic.name),
+		playlist.UserId, playlist.Name, true)
 
 	var public bool
 	err := row.Scan(&public)
@@ -200,14 +313,14 @@ func (playlistsDB *PlaylistsDB) AddIdToPlaylist(playlistId PlaylistId) error {
 	defer playlistsDB.rwLock.Unlock()
 
 	ids, err := playlistsDB.getPlaylistIds(Playlist{
-		ApiKey: playlistId.ApiKey, Name: playlistId.Name})
+		UserId: playlistId.UserId, Name: playlistId.Name})
 	if err != nil {
 		return err
 	}
 
 	ids = append(ids, playlistId.Id)
 	return playlistsDB.setPlaylistIds(PlaylistIds{
-		playlistId.ApiKey, playlistId.Name, ids})
+		playlistId.UserId, playlistId.Name, ids})
 }
 
 func (playlistsDB *PlaylistsDB) DeleteIdFromPlaylist(playlistId PlaylistId) error {
@@ -215,7 +328,7 @@ func (playlistsDB *PlaylistsDB) DeleteIdFromPlaylist(playlistId PlaylistId) erro
 	defer playlistsDB.rwLock.Unlock()
 
 	ids, err := playlistsDB.getPlaylistIds(Playlist{
-		ApiKey: playlistId.ApiKey, Name: playlistId.Name})
+		UserId: playlistId.UserId, Name: playlistId.Name})
 	if err != nil {
 		return err
 	}
@@ -228,13 +341,13 @@ func (playlistsDB *PlaylistsDB) DeleteIdFromPlaylist(playlistId PlaylistId) erro
 		}
 	}
 	if index < 0 {
-		return fmt.Errorf("id to delete not found")
+		return ErrIdNotFound
 	}
 
 	newIds := ids[:index]
 	newIds = append(newIds, ids[index+1:]...)
 	return playlistsDB.setPlaylistIds(PlaylistIds{
-		playlistId.ApiKey, playlistId.Name, newIds})
+		playlistId.UserId, playlistId.Name, newIds})
 }
 
 func (playlistsDB *PlaylistsDB) SetPlaylistIds(playlistIds PlaylistIds) error {
@@ -247,14 +360,14 @@ func (playlistsDB *PlaylistsDB) setPlaylistIds(playlistIds PlaylistIds) error {
 	set := make(map[string]struct{})
 	for _, id := range playlistIds.Ids {
 		if _, ok := set[id]; ok {
-			return fmt.Errorf("duplicate in ids")
+			return ErrDuplicateIds
 		}
 		set[id] = struct{}{}
 	}
 
 	_, err := playlistsDB.db.Exec(fmt.Sprintf(
 		"UPDATE %s SET %s = ? WHERE %s = ? AND %s = ?",
-		TablePlaylists, ColumnIds.name, ColumnApikey.name, ColumnName.name),
-		strings.Join(playlistIds.Ids, ","), playlistIds.ApiKey, playlistIds.Name)
+		TablePlaylists, ColumnIds.name, ColumnUserId.name, ColumnName.name),
+		strings.Join(playlistIds.Ids, ","), playlistIds.UserId, playlistIds.Name)
 	return err
 }
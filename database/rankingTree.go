@@ -9,6 +9,21 @@ type rankingInterface interface {
 	GetCount() int
 }
 
+// rankingKey is what the rankings hold of songs and searches,
+// the cached structs hold locks and must not be copied
+type rankingKey struct {
+	id    string
+	count int
+}
+
+func (key rankingKey) GetUniqueId() string {
+	return key.id
+}
+
+func (key rankingKey) GetCount() int {
+	return key.count
+}
+
 type rankingTree struct {
 	start *node
 	size  int
@@ -63,6 +78,13 @@ func (tree *rankingTree) getSize() int {
 	return tree.size
 }
 
+func (tree *rankingTree) clear() {
+	tree.lock.Lock()
+	defer tree.lock.Unlock()
+	tree.start = nil
+	tree.size = 0
+}
+
 type node struct {
 	rankingItem rankingInterface
 	left, right *node
@@ -1,7 +1,5 @@
 package database
 
-import "strings"
-
 type tableBuilder struct {
 	name            string
 	primaryKeys     []column
@@ -37,28 +35,27 @@ func (tableBuilder *tableBuilder) addColumn(column column) *tableBuilder {
 func (tableBuilder *tableBuilder) build() string {
 	cmd := "CREATE TABLE IF NOT EXISTS " + tableBuilder.name + " ("
 
+	// Columns can be keys of several kinds, they are only declared once
+	declared := make(map[string]bool)
+	declare := func(name string, dataType dataType, constraint string) {
+		if !declared[name] {
+			declared[name] = true
+			cmd += name + " " + string(dataType) + constraint + ","
+		}
+	}
 	for _, foreignKey := range tableBuilder.foreignKeys {
-		cmd += foreignKey.name + " " + string(foreignKey.dataType) + " NOT NULL,"
+		declare(foreignKey.name, foreignKey.dataType, " NOT NULL")
 	}
 	for _, primaryKey := range tableBuilder.primaryKeys {
-		line := primaryKey.name + " " + string(primaryKey.dataType)
-		if !strings.Contains(cmd, line) {
-			cmd += line + " NOT NULL,"
-		}
+		declare(primaryKey.name, primaryKey.dataType, " NOT NULL")
 	}
 	for _, uniqueKeyPair := range tableBuilder.uniqueKeysPairs {
 		for _, uniqueKey := range uniqueKeyPair {
-			line := uniqueKey.name + " " + string(uniqueKey.dataType)
-			if !strings.Contains(cmd, line) {
-				cmd += line + ","
-			}
+			declare(uniqueKey.name, uniqueKey.dataType, "")
 		}
 	}
 	for _, column := range tableBuilder.columns {
-		line := column.name + " " + string(column.dataType)
-		if !strings.Contains(cmd, line) {
-			cmd += line + ","
-		}
+		declare(column.name, column.dataType, "")
 	}
 
 	referenceTables := make(map[string][]foreignKey)
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"reflect"
 	"regexp"
+	"strconv"
 	"sync"
 
 	"github.com/Grarak/GoYTFetcher/utils"
@@ -15,7 +16,18 @@ import (
 
 const TableUsers = "users"
 
+// Signup policies, the first user can always sign up
+const (
+	// SignupOpen verifies new users right away
+	SignupOpen = "open"
+	// SignupInvite lets new users wait until an admin verifies them
+	SignupInvite = "invite"
+	// SignupClosed rejects new users
+	SignupClosed = "closed"
+)
+
 type User struct {
+	Id           string `json:"-"`
 	ApiKey       string `json:"apikey,omitempty"`
 	Name         string `json:"name,omitempty"`
 	Password     string `json:"password,omitempty"`
@@ -64,21 +76,25 @@ type UsersDB struct {
 	db     *sql.DB
 	rwLock *sync.RWMutex
 
-	namePattern *regexp.Regexp
+	namePattern  *regexp.Regexp
+	signupPolicy string
 }
 
-func newUsersDB(db *sql.DB, rwLock *sync.RWMutex) (*UsersDB, error) {
-	cmd := newTableBuilder(TableUsers).
-		addUniqueKeyPair(ColumnApikey).
+func usersTable() string {
+	return newTableBuilder(TableUsers).
+		addPrimaryKey(ColumnUserId).
 		addUniqueKeyPair(ColumnName).
 		addColumn(ColumnPasswordSalt).
 		addColumn(ColumnPasswordHash).
 		addColumn(ColumnAdmin).
 		addColumn(ColumnVerified).build()
+}
 
-	_, err := db.Exec(cmd)
-	if err != nil {
-		return nil, err
+func newUsersDB(db *sql.DB, rwLock *sync.RWMutex) (*UsersDB, error) {
+	for _, cmd := range []string{usersTable(), apiKeysTable()} {
+		if _, err := db.Exec(cmd); err != nil {
+			return nil, err
+		}
 	}
 
 	regex, err := regexp.Compile("^[a-zA-Z0-9_]*$")
@@ -86,7 +102,21 @@ func newUsersDB(db *sql.DB, rwLock *sync.RWMutex) (*UsersDB, error) {
 		return nil, err
 	}
 
-	return &UsersDB{db, rwLock, regex}, nil
+	return &UsersDB{db, rwLock, regex, SignupInvite}, nil
+}
+
+// SetSignupPolicy decides who may sign up, it's meant to be called on startup
+func (usersDB *UsersDB) SetSignupPolicy(policy string) error {
+	switch policy {
+	case SignupOpen, SignupInvite, SignupClosed:
+		usersDB.signupPolicy = policy
+		return nil
+	}
+	return fmt.Errorf("unknown signup policy %s", policy)
+}
+
+func (usersDB *UsersDB) SignupPolicy() string {
+	return usersDB.signupPolicy
 }
 
 func (usersDB *UsersDB) AddUser(user User) (User, int) {
@@ -122,42 +152,52 @@ func (usersDB *UsersDB) AddUser(user User) (User, int) {
 		return user, utils.StatusUserAlreadyExists
 	}
 
+	// The first user becomes admin, even if signups are closed
+	count, _ := rowCountInTable(usersDB.db, TableUsers)
+	if count > 0 && usersDB.signupPolicy == SignupClosed {
+		return user, utils.StatusSignupClosed
+	}
+
 	// Hash password
 	hash, salt := generatePassword(password)
 
-	// Generate api token
-	user.ApiKey = usersDB.generateApiToken()
-
+	user.Id = generateUserId()
 	user.Password = ""
 
-	// If this is the first user
-	// Make him admin
-	count, _ := rowCountInTable(usersDB.db, TableUsers)
-	var admin bool
-	var verified bool
-	if count == 0 {
-		admin = true
-		verified = true
-	}
+	admin := count == 0
+	verified := admin || usersDB.signupPolicy == SignupOpen
 	user.Admin = &admin
 	user.Verified = &verified
 
-	_, err = usersDB.db.Exec(fmt.Sprintf(
+	tx, err := usersDB.db.Begin()
+	if err != nil {
+		return user, utils.StatusAddUserFailed
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(fmt.Sprintf(
 
 		"INSERT INTO %s "+
 			"(%s, %s, %s, %s, %s, %s) "+
 			"VALUES (?, ?, ?, ?, ?, ?)",
 		TableUsers,
-		ColumnApikey.name, ColumnName.name,
+		ColumnUserId.name, ColumnName.name,
 		ColumnPasswordSalt.name, ColumnPasswordHash.name,
 		ColumnAdmin.name, ColumnVerified.name),
 
-		user.ApiKey, user.Name, salt, hash,
+		user.Id, user.Name, salt, hash,
 		*user.Admin, *user.Verified)
 	if err != nil {
 		return user, utils.StatusAddUserFailed
 	}
 
+	// Generate api token
+	apiKey, err := usersDB.createApiKey(tx, user.Id, SignupApiKeyName, nil)
+	if err != nil || tx.Commit() != nil {
+		return user, utils.StatusAddUserFailed
+	}
+	user.ApiKey = apiKey.Key
+
 	return user, utils.StatusNoError
 }
 
@@ -181,23 +221,13 @@ func (usersDB *UsersDB) GetUserWithPassword(name, password string) (User, int) {
 	return User{}, utils.StatusInvalidPassword
 }
 
-func (usersDB *UsersDB) generateApiToken() string {
-	token := utils.ToURLBase64(utils.GenerateRandom(32))
-	if _, err := usersDB.findUserByApiKey(token); err == nil {
-		return usersDB.generateApiToken()
-	}
-	return token
+func generateUserId() string {
+	return utils.ToURLBase64(utils.GenerateRandom(16))
 }
 
-func (usersDB *UsersDB) FindUserByApiKey(apiKey string) (User, error) {
-	usersDB.rwLock.RLock()
-	defer usersDB.rwLock.RUnlock()
-	return usersDB.findUserByApiKey(apiKey)
-}
-
-func (usersDB *UsersDB) findUserByApiKey(apiKey string) (User, error) {
+func (usersDB *UsersDB) findUserById(id string) (User, error) {
 	users, err := usersDB.createUserWithWhere(
-		ColumnApikey.name+" = ?", apiKey)
+		ColumnUserId.name+" = ?", id)
 	if len(users) > 0 {
 		return users[0], err
 	}
@@ -219,25 +249,78 @@ func (usersDB *UsersDB) findUserByName(name string) (User, error) {
 	return User{}, fmt.Errorf("no users found")
 }
 
-func (usersDB *UsersDB) ListUsers(page int) ([]User, error) {
+// UserFilter narrows ListUsers down, nil flags match everyone
+type UserFilter struct {
+	Verified *bool
+	Admin    *bool
+	Sort     string
+}
+
+func (filter UserFilter) query() string {
+	flag := func(value *bool) string {
+		if value == nil {
+			return ""
+		}
+		return strconv.FormatBool(*value)
+	}
+	return "users," + flag(filter.Verified) + "," + flag(filter.Admin) + "," + filter.Sort
+}
+
+// ListUsers returns a page of users
+func (usersDB *UsersDB) ListUsers(filter UserFilter, request PageRequest) (UsersPage, error) {
 	usersDB.rwLock.RLock()
 	defer usersDB.rwLock.RUnlock()
 
-	if page < 1 {
-		page = 1
+	order, err := sortName(filter.Sort)
+	if err != nil {
+		return UsersPage{}, err
 	}
-	users, err := usersDB.createUsers(fmt.Sprintf(
-		"LIMIT 10 OFFSET %d", 10*(page-1)))
+	query := filter.query()
+	after, err := request.after(query)
 	if err != nil {
-		return nil, err
+		return UsersPage{}, err
+	}
+
+	where := "WHERE 1"
+	var args []interface{}
+	if filter.Verified != nil {
+		where += fmt.Sprintf(" AND IFNULL(%s, 0) = ?", ColumnVerified.name)
+		args = append(args, *filter.Verified)
+	}
+	if filter.Admin != nil {
+		where += fmt.Sprintf(" AND IFNULL(%s, 0) = ?", ColumnAdmin.name)
+		args = append(args, *filter.Admin)
 	}
 
-	usersNoApiKey := make([]User, len(users))
-	for i := range users {
-		usersNoApiKey[i] = users[i]
-		usersNoApiKey[i].ApiKey = ""
+	var total int
+	err = usersDB.db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s %s",
+		TableUsers, where), args...).Scan(&total)
+	if err != nil {
+		return UsersPage{}, err
 	}
-	return usersNoApiKey, nil
+
+	if after != nil {
+		keyset, keysetArgs := afterName(filter.Sort, after.Name)
+		where += keyset
+		args = append(args, keysetArgs...)
+	}
+	users, err := usersDB.createUsers(where+order+" LIMIT ? OFFSET ?",
+		append(args, request.size()+1, request.offset())...)
+	if err != nil {
+		return UsersPage{}, err
+	}
+
+	more := len(users) > request.size()
+	if more {
+		users = users[:request.size()]
+	}
+	page := UsersPage{Items: append(make([]User, 0, len(users)), users...)}
+	var last cursor
+	if len(users) > 0 {
+		last = cursor{Query: query, Name: users[len(users)-1].Name}
+	}
+	page.PageInfo = newPageInfo(last, more, total)
+	return page, nil
 }
 
 func (usersDB *UsersDB) SetVerificationUser(request User) error {
@@ -254,20 +337,38 @@ func (usersDB *UsersDB) DeleteUser(request User) error {
 	usersDB.rwLock.Lock()
 	defer usersDB.rwLock.Unlock()
 
-	_, err := usersDB.db.Exec(fmt.Sprintf(
-		"DELETE FROM %s WHERE %s = ?",
-		TableUsers, ColumnName.name), request.Name)
-	return err
+	return usersDB.deleteUsers(ColumnName.name+" = ?", request.Name)
 }
 
 func (usersDB *UsersDB) DeleteAllNonVerifiedUsers(request User) error {
 	usersDB.rwLock.Lock()
 	defer usersDB.rwLock.Unlock()
 
-	_, err := usersDB.db.Exec(fmt.Sprintf(
-		"DELETE FROM %s WHERE %s = %d OR %s = null",
-		TableUsers, ColumnVerified.name, 0, ColumnVerified.name))
-	return err
+	return usersDB.deleteUsers(fmt.Sprintf("IFNULL(%s, 0) = 0", ColumnVerified.name))
+}
+
+// deleteUsers removes the users matching where together with
+// their apikeys, playlists and histories
+func (usersDB *UsersDB) deleteUsers(where string, args ...interface{}) error {
+	tx, err := usersDB.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{TableApiKeys, TablePlaylists, TableHistories} {
+		_, err := tx.Exec(fmt.Sprintf(
+			"DELETE FROM %s WHERE %s IN (SELECT %s FROM %s WHERE %s)",
+			table, ColumnUserId.name, ColumnUserId.name, TableUsers, where), args...)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s", TableUsers, where), args...)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func (usersDB *UsersDB) ResetPasswordUser(request User) error {
@@ -298,7 +399,7 @@ func (usersDB *UsersDB) createUserWithWhere(where string, args ...interface{}) (
 func (usersDB *UsersDB) createUsers(condition string, args ...interface{}) ([]User, error) {
 	stmt, err := usersDB.db.Prepare(fmt.Sprintf(
 		"SELECT %s,%s,%s,%s,%s,%s FROM %s %s",
-		ColumnApikey.name, ColumnName.name, ColumnPasswordSalt.name,
+		ColumnUserId.name, ColumnName.name, ColumnPasswordSalt.name,
 		ColumnPasswordHash.name, ColumnAdmin.name,
 		ColumnVerified.name, TableUsers, condition))
 	if err != nil {
@@ -317,7 +418,7 @@ func (usersDB *UsersDB) createUsers(condition string, args ...interface{}) ([]Us
 		admin := false
 		verified := false
 		user := User{Admin: &admin, Verified: &verified}
-		err := rows.Scan(&user.ApiKey, &user.Name, &user.PasswordSalt,
+		err := rows.Scan(&user.Id, &user.Name, &user.PasswordSalt,
 			&user.PasswordHash, user.Admin, user.Verified)
 		if err != nil {
 			return nil, err
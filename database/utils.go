@@ -2,12 +2,16 @@ package database
 
 import (
 	"database/sql"
+	"strings"
 )
 
 const (
 	dateTimeFormat = "2006-01-02 15:04:05"
 )
 
+// likeEscaper escapes the wildcards of LIKE patterns using ESCAPE '\'
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
 func rowCountInTable(db *sql.DB, table string) (int, error) {
 	row := db.QueryRow("SELECT Count(*) FROM " + table)
 	var count int
@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -15,10 +16,11 @@ import (
 )
 
 type Youtube struct {
-	ApiKey      string `json:"apikey"`
-	SearchQuery string `json:"searchquery"`
-	Id          string `json:"id"`
-	AddHistory  bool   `json:"addhistory"`
+	ApiKey      string   `json:"apikey"`
+	SearchQuery string   `json:"searchquery"`
+	Id          string   `json:"id"`
+	Ids         []string `json:"ids,omitempty"`
+	AddHistory  bool     `json:"addhistory"`
 }
 
 func NewYoutube(data []byte) (Youtube, error) {
@@ -32,7 +34,20 @@ type YouTubeDB interface {
 	FetchYoutubeSong(id string) (string, string, error)
 	GetYoutubeSearch(searchQuery string) ([]YoutubeSearchResult, error)
 	GetYoutubeInfo(id string) (YoutubeSearchResult, error)
+	GetYoutubeInfos(ids []string) []YoutubeInfo
 	GetYoutubeCharts() ([]YoutubeSearchResult, error)
+	ChartsAvailable() bool
+	HasApiKey() bool
+	SubscribeSongEvents() (<-chan YoutubeSongEvent, func())
+	ListCachedSongs() []CachedSong
+	ListCachedSearches() []CachedSearch
+	EvictYoutubeSong(id string) error
+	RedownloadYoutubeSong(id string) error
+	EvictYoutubeSearch(searchQuery string) error
+	PurgeYoutubeSearches() int
+	CacheUsage() (CacheUsage, error)
+	LastExtraction() (time.Time, error)
+	Shutdown(ctx context.Context) error
 }
 
 type youtubeDBImpl struct {
@@ -52,9 +67,22 @@ type youtubeDBImpl struct {
 
 	deleteCacheLock sync.RWMutex
 
+	downloadCtx     context.Context
+	cancelDownloads context.CancelFunc
+	downloads       sync.WaitGroup
+	downloadsLock   sync.Mutex
+	shuttingDown    bool
+
+	songEvents *songEventBroker
+
+	lastExtraction    time.Time
+	lastExtractionErr error
+	extractionLock    sync.RWMutex
+
 	charts            []YoutubeSearchResult
 	chartsLock        sync.RWMutex
 	chartsLastFetched time.Time
+	chartsErr         error
 }
 
 func newYoutubeDB(key []byte, ytKey string) (YouTubeDB, error) {
@@ -70,7 +98,10 @@ func newYoutubeDB(key []byte, ytKey string) (YouTubeDB, error) {
 		idRanking:       new(rankingTree),
 		randomKey:       key,
 		ytKey:           ytKey,
+		songEvents:      newSongEventBroker(),
 	}
+	youtubeDB.downloadCtx, youtubeDB.cancelDownloads = context.WithCancel(context.Background())
+	youtubeDB.registerMetrics()
 
 	files, err := ioutil.ReadDir(utils.YOUTUBE_DIR)
 	if err != nil {
@@ -84,8 +115,9 @@ func newYoutubeDB(key []byte, ytKey string) (YouTubeDB, error) {
 
 			youtubeSong := newYoutubeSong(id)
 			youtubeSong.setDownloaded(true)
+			youtubeSong.setLastAccess(file.ModTime())
 			youtubeSong.filePath = utils.YOUTUBE_DIR + "/" + file.Name()
-			youtubeDB.songsRanking.insert(*youtubeSong)
+			youtubeDB.songsRanking.insert(youtubeSong.rankingKey())
 			youtubeDB.songs.Store(id, youtubeSong)
 		}
 	}
@@ -109,17 +141,30 @@ func (youtubeDB *youtubeDBImpl) GetYoutubeSong(id string) (*YoutubeSong, error)
 
 func (youtubeDB *youtubeDBImpl) FetchYoutubeSong(id string) (string, string, error) {
 	id = strings.TrimSpace(id)
+	if !videoIdRegex.MatchString(id) {
+		return "", "", ErrInvalidVideoId
+	}
 	youtubeSong := newYoutubeSong(id)
 	loadedSong, loaded := youtubeDB.songs.LoadOrStore(id, youtubeSong)
 	if loaded {
 		youtubeSong = loadedSong.(*YoutubeSong)
-		youtubeSong.increaseCount()
 	}
 
 	youtubeSong.songLock.Lock()
 	defer youtubeSong.songLock.Unlock()
+	if youtubeSong.isDeleted() {
+		// Evicted while waiting for the lock, start over with a new song
+		return youtubeDB.FetchYoutubeSong(id)
+	}
+
+	// The ranking holds the count the song had when it was inserted
+	previousKey := youtubeSong.rankingKey()
+	if loaded {
+		youtubeSong.increaseCount()
+	}
 
 	encryptedId := youtubeSong.getEncryptedId(youtubeDB.randomKey)
+	cacheLookups.Inc("fetch", cacheResult(youtubeSong.isDownloaded()))
 	var link string
 	if youtubeSong.isDownloaded() {
 		link = encryptedId
@@ -128,13 +173,7 @@ func (youtubeDB *youtubeDBImpl) FetchYoutubeSong(id string) (string, string, err
 	} else if !loaded {
 		link, _ = youtubeSong.getDownloadUrl()
 		if !utils.StringIsEmpty(link) {
-			go func() {
-				youtubeDB.deleteCacheLock.RLock()
-				defer youtubeDB.deleteCacheLock.RUnlock()
-				if err := youtubeSong.download(youtubeDB); err != nil {
-					logger.E(fmt.Sprintf("Failed to download %s %s", youtubeSong.id, err))
-				}
-			}()
+			youtubeDB.queueDownload(youtubeSong)
 		}
 	}
 
@@ -143,21 +182,15 @@ func (youtubeDB *youtubeDBImpl) FetchYoutubeSong(id string) (string, string, err
 		return "", "", fmt.Errorf("%s: failed to get url", youtubeSong.id)
 	}
 
-	youtubeDB.songsRanking.delete(*youtubeSong)
-	youtubeDB.songsRanking.insert(*youtubeSong)
+	youtubeDB.songsRanking.delete(previousKey)
+	youtubeDB.songsRanking.insert(youtubeSong.rankingKey())
 	if youtubeDB.songsRanking.getSize() >= 1000 {
 		lowestSong := youtubeDB.songsRanking.getLowest()
 		youtubeDB.songsRanking.delete(lowestSong)
 
 		loadedSong, loaded = youtubeDB.songs.Load(lowestSong.GetUniqueId())
 		if loaded {
-			youtubeSong := loadedSong.(*YoutubeSong)
-
-			youtubeDB.songs.Delete(lowestSong.GetUniqueId())
-
-			youtubeDB.deleteCacheLock.Lock()
-			youtubeSong.delete()
-			youtubeDB.deleteCacheLock.Unlock()
+			youtubeDB.evictSong(loadedSong.(*YoutubeSong))
 		}
 	}
 
@@ -171,10 +204,13 @@ func (youtubeDB *youtubeDBImpl) GetYoutubeSearch(searchQuery string) ([]YoutubeS
 
 	youtubeSearch := newYoutubeSearch(searchQuery)
 	loadedSearch, loaded := youtubeDB.searches.LoadOrStore(youtubeSearch.query, youtubeSearch)
+	previousKey := youtubeSearch.rankingKey()
 	if loaded {
 		youtubeSearch = loadedSearch.(*YoutubeSearch)
+		previousKey = youtubeSearch.rankingKey()
 		youtubeSearch.increaseCount()
 	}
+	cacheLookups.Inc("search", cacheResult(loaded))
 
 	var results []YoutubeSearchResult
 	var err error
@@ -185,12 +221,12 @@ func (youtubeDB *youtubeDBImpl) GetYoutubeSearch(searchQuery string) ([]YoutubeS
 	}
 
 	if err == nil {
-		youtubeDB.searchesRanking.delete(*youtubeSearch)
-		youtubeDB.songsRanking.insert(*youtubeSearch)
-		if youtubeDB.songsRanking.getSize() >= 1000 {
-			lowestSearch := youtubeDB.songsRanking.getLowest()
-			youtubeDB.songsRanking.delete(lowestSearch)
-			youtubeDB.songs.Delete(lowestSearch.GetUniqueId())
+		youtubeDB.searchesRanking.delete(previousKey)
+		youtubeDB.searchesRanking.insert(youtubeSearch.rankingKey())
+		if youtubeDB.searchesRanking.getSize() >= 1000 {
+			lowestSearch := youtubeDB.searchesRanking.getLowest()
+			youtubeDB.searchesRanking.delete(lowestSearch)
+			youtubeDB.searches.Delete(lowestSearch.GetUniqueId())
 		}
 	} else {
 		youtubeDB.searches.Delete(youtubeSearch.query)
@@ -211,6 +247,7 @@ func (youtubeDB *youtubeDBImpl) GetYoutubeInfo(id string) (YoutubeSearchResult,
 		youtubeId = loadedId.(*YoutubeId)
 		youtubeId.increaseCount()
 	}
+	cacheLookups.Inc("getinfo", cacheResult(loaded))
 
 	var result YoutubeSearchResult
 	var err error
@@ -242,6 +279,7 @@ func (youtubeDB *youtubeDBImpl) GetYoutubeCharts() ([]YoutubeSearchResult, error
 		defer youtubeDB.chartsLock.Unlock()
 
 		charts, err := getYoutubeCharts()
+		youtubeDB.chartsErr = err
 		if err != nil {
 			return nil, err
 		}
@@ -253,3 +291,102 @@ func (youtubeDB *youtubeDBImpl) GetYoutubeCharts() ([]YoutubeSearchResult, error
 	defer youtubeDB.chartsLock.RUnlock()
 	return youtubeDB.charts, nil
 }
+
+// ChartsAvailable is false while the charts can't be fetched,
+// they are scraped and don't need the youtube api key
+func (youtubeDB *youtubeDBImpl) ChartsAvailable() bool {
+	youtubeDB.chartsLock.RLock()
+	defer youtubeDB.chartsLock.RUnlock()
+	return youtubeDB.chartsErr == nil
+}
+
+// HasApiKey tells if searches and infos can fall back to the youtube data api
+func (youtubeDB *youtubeDBImpl) HasApiKey() bool {
+	return !utils.StringIsEmpty(youtubeDB.ytKey)
+}
+
+// SubscribeSongEvents returns a channel with the state changes of all songs,
+// call the returned function once no longer interested
+func (youtubeDB *youtubeDBImpl) SubscribeSongEvents() (<-chan YoutubeSongEvent, func()) {
+	return youtubeDB.songEvents.subscribe()
+}
+
+func (youtubeDB *youtubeDBImpl) publishSongEvent(youtubeSong *YoutubeSong,
+	state string, progress float64, reason string) {
+	if state == SongDownloaded || state == SongFailed {
+		finishedDownloads.Inc(state)
+	}
+	youtubeDB.songEvents.publish(YoutubeSongEvent{
+		Id:       youtubeSong.id,
+		FetchId:  youtubeSong.getEncryptedId(youtubeDB.randomKey),
+		State:    state,
+		Progress: progress,
+		Reason:   reason,
+	})
+}
+
+// queueDownload downloads youtubeSong in the background,
+// nothing is started once the server is shutting down
+func (youtubeDB *youtubeDBImpl) queueDownload(youtubeSong *YoutubeSong) bool {
+	if !youtubeDB.startDownload() {
+		return false
+	}
+	youtubeDB.publishSongEvent(youtubeSong, SongQueued, 0, "")
+	go func() {
+		defer youtubeDB.downloads.Done()
+		activeDownloads.Inc()
+		defer activeDownloads.Dec()
+		youtubeDB.deleteCacheLock.RLock()
+		defer youtubeDB.deleteCacheLock.RUnlock()
+		if err := youtubeSong.download(youtubeDB); err != nil {
+			logger.E(fmt.Sprintf("Failed to download %s %s", youtubeSong.id, err))
+		}
+	}()
+	return true
+}
+
+// evictSong forgets youtubeSong and removes its file,
+// it has to be taken out of songsRanking already
+func (youtubeDB *youtubeDBImpl) evictSong(youtubeSong *YoutubeSong) {
+	youtubeDB.songs.Delete(youtubeSong.id)
+
+	youtubeDB.deleteCacheLock.Lock()
+	youtubeSong.delete()
+	youtubeDB.deleteCacheLock.Unlock()
+	youtubeDB.publishSongEvent(youtubeSong, SongEvicted, 0, "")
+}
+
+// startDownload registers a background download,
+// no new ones are accepted once the shutdown started
+func (youtubeDB *youtubeDBImpl) startDownload() bool {
+	youtubeDB.downloadsLock.Lock()
+	defer youtubeDB.downloadsLock.Unlock()
+	if youtubeDB.shuttingDown {
+		return false
+	}
+	youtubeDB.downloads.Add(1)
+	return true
+}
+
+// Shutdown waits for active downloads until ctx is done,
+// the remaining ones get cancelled and their partial files removed
+func (youtubeDB *youtubeDBImpl) Shutdown(ctx context.Context) error {
+	youtubeDB.downloadsLock.Lock()
+	youtubeDB.shuttingDown = true
+	youtubeDB.downloadsLock.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		youtubeDB.downloads.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		youtubeDB.cancelDownloads()
+		<-finished
+		return ctx.Err()
+	}
+}
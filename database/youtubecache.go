@@ -0,0 +1,210 @@
+package database
+
+import (
+	"errors"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Grarak/GoYTFetcher/utils"
+)
+
+// SongStreamed is the cache state of songs which are known but not downloaded,
+// e.g. because they are too long or their download failed
+const SongStreamed = "streamed"
+
+var ErrNotCached = errors.New("not cached")
+var ErrSongDownloading = errors.New("song is downloading")
+var ErrShuttingDown = errors.New("server is shutting down")
+
+// CachedSong is a song the server knows, Size is 0 unless it's downloaded
+type CachedSong struct {
+	Id         string    `json:"id"`
+	State      string    `json:"state"`
+	Size       int64     `json:"size"`
+	Count      int       `json:"count"`
+	LastAccess time.Time `json:"lastaccess"`
+}
+
+type CachedSearch struct {
+	Query   string `json:"query"`
+	Count   int    `json:"count"`
+	Results int    `json:"results"`
+}
+
+// CacheUsage counts the cache entries, Files and Size are what is
+// actually in the youtube directory, including partial downloads
+type CacheUsage struct {
+	Songs    int   `json:"songs"`
+	Searches int   `json:"searches"`
+	Infos    int   `json:"infos"`
+	Files    int   `json:"files"`
+	Size     int64 `json:"size"`
+}
+
+func (youtubeSong *YoutubeSong) cacheState() string {
+	youtubeSong.stateLock.RLock()
+	defer youtubeSong.stateLock.RUnlock()
+	switch {
+	case youtubeSong.downloading:
+		return SongDownloading
+	case youtubeSong.downloaded:
+		return SongDownloaded
+	}
+	return SongStreamed
+}
+
+// ListCachedSongs returns the songs, the most recently used first
+func (youtubeDB *youtubeDBImpl) ListCachedSongs() []CachedSong {
+	songs := make([]CachedSong, 0)
+	youtubeDB.songs.Range(func(key, value interface{}) bool {
+		youtubeSong := value.(*YoutubeSong)
+		youtubeSong.stateLock.RLock()
+		count := youtubeSong.count
+		youtubeSong.stateLock.RUnlock()
+
+		songs = append(songs, CachedSong{
+			Id:         youtubeSong.id,
+			State:      youtubeSong.cacheState(),
+			Size:       youtubeSong.fileSize(),
+			Count:      count,
+			LastAccess: youtubeSong.getLastAccess(),
+		})
+		return true
+	})
+	sort.Slice(songs, func(i, j int) bool {
+		return songs[i].LastAccess.After(songs[j].LastAccess)
+	})
+	return songs
+}
+
+// ListCachedSearches returns the searches, the most requested first
+func (youtubeDB *youtubeDBImpl) ListCachedSearches() []CachedSearch {
+	searches := make([]CachedSearch, 0)
+	youtubeDB.searches.Range(func(key, value interface{}) bool {
+		youtubeSearch := value.(*YoutubeSearch)
+		youtubeSearch.valuesLock.RLock()
+		count := youtubeSearch.count
+		youtubeSearch.valuesLock.RUnlock()
+
+		searches = append(searches, CachedSearch{
+			Query:   youtubeSearch.query,
+			Count:   count,
+			Results: len(youtubeSearch.getResults()),
+		})
+		return true
+	})
+	sort.Slice(searches, func(i, j int) bool {
+		if searches[i].Count != searches[j].Count {
+			return searches[i].Count > searches[j].Count
+		}
+		return searches[i].Query < searches[j].Query
+	})
+	return searches
+}
+
+func (youtubeDB *youtubeDBImpl) loadSong(id string) (*YoutubeSong, error) {
+	loadedSong, ok := youtubeDB.songs.Load(id)
+	if !ok {
+		return nil, ErrNotCached
+	}
+	return loadedSong.(*YoutubeSong), nil
+}
+
+// EvictYoutubeSong forgets the song and removes its file,
+// songs which are being downloaded can't be evicted
+func (youtubeDB *youtubeDBImpl) EvictYoutubeSong(id string) error {
+	youtubeSong, err := youtubeDB.loadSong(id)
+	if err != nil {
+		return err
+	}
+
+	youtubeSong.songLock.Lock()
+	defer youtubeSong.songLock.Unlock()
+	if youtubeSong.IsDownloading() {
+		return ErrSongDownloading
+	}
+
+	youtubeDB.songsRanking.delete(youtubeSong.rankingKey())
+	youtubeDB.evictSong(youtubeSong)
+	return nil
+}
+
+// RedownloadYoutubeSong replaces the file of the song, e.g. if it's corrupt
+func (youtubeDB *youtubeDBImpl) RedownloadYoutubeSong(id string) error {
+	youtubeSong, err := youtubeDB.loadSong(id)
+	if err != nil {
+		return err
+	}
+
+	youtubeSong.songLock.Lock()
+	defer youtubeSong.songLock.Unlock()
+	if youtubeSong.IsDownloading() {
+		return ErrSongDownloading
+	}
+
+	youtubeDB.deleteCacheLock.Lock()
+	youtubeSong.removeFile()
+	youtubeDB.deleteCacheLock.Unlock()
+
+	// Fetches in between have to see the download already
+	youtubeSong.setDownloading(true)
+	if !youtubeDB.queueDownload(youtubeSong) {
+		youtubeSong.setDownloading(false)
+		return ErrShuttingDown
+	}
+	return nil
+}
+
+func (youtubeDB *youtubeDBImpl) EvictYoutubeSearch(searchQuery string) error {
+	youtubeSearch := newYoutubeSearch(searchQuery)
+	loadedSearch, ok := youtubeDB.searches.Load(youtubeSearch.query)
+	if !ok {
+		return ErrNotCached
+	}
+	youtubeDB.searchesRanking.delete(loadedSearch.(*YoutubeSearch).rankingKey())
+	youtubeDB.searches.Delete(youtubeSearch.query)
+	return nil
+}
+
+// PurgeYoutubeSearches forgets all searches and returns how many there were
+func (youtubeDB *youtubeDBImpl) PurgeYoutubeSearches() int {
+	purged := 0
+	youtubeDB.searchesRanking.clear()
+	youtubeDB.searches.Range(func(key, value interface{}) bool {
+		youtubeDB.searches.Delete(key)
+		purged++
+		return true
+	})
+	return purged
+}
+
+func (youtubeDB *youtubeDBImpl) CacheUsage() (CacheUsage, error) {
+	usage := CacheUsage{
+		Songs:    mapSize(&youtubeDB.songs),
+		Searches: mapSize(&youtubeDB.searches),
+		Infos:    mapSize(&youtubeDB.ids),
+	}
+
+	files, err := ioutil.ReadDir(utils.YOUTUBE_DIR)
+	if err != nil {
+		return usage, err
+	}
+	for _, file := range files {
+		if !file.IsDir() {
+			usage.Files++
+			usage.Size += file.Size()
+		}
+	}
+	return usage, nil
+}
+
+func mapSize(entries *sync.Map) int {
+	size := 0
+	entries.Range(func(key, value interface{}) bool {
+		size++
+		return true
+	})
+	return size
+}
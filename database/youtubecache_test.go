@@ -0,0 +1,132 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+type offlineTransport struct{}
+
+func (offlineTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, errors.New("offline")
+}
+
+func newTestYoutubeDB() *youtubeDBImpl {
+	youtubeDB := &youtubeDBImpl{
+		songsRanking:    new(rankingTree),
+		searchesRanking: new(rankingTree),
+		idRanking:       new(rankingTree),
+		randomKey:       make([]byte, 16),
+		songEvents:      newSongEventBroker(),
+	}
+	youtubeDB.downloadCtx, youtubeDB.cancelDownloads = context.WithCancel(context.Background())
+	return youtubeDB
+}
+
+// addDownloadedSong caches a song like a finished download
+func addDownloadedSong(t *testing.T, youtubeDB *youtubeDBImpl, dir, id string) {
+	youtubeSong := newYoutubeSong(id)
+	youtubeSong.filePath = filepath.Join(dir, id+".ogg")
+	if err := ioutil.WriteFile(youtubeSong.filePath, []byte("OggS"), 0644); err != nil {
+		t.Error(err)
+		return
+	}
+	youtubeSong.setDownloaded(true)
+
+	// Fetches wait until the song is ranked
+	youtubeSong.songLock.Lock()
+	defer youtubeSong.songLock.Unlock()
+	if _, loaded := youtubeDB.songs.LoadOrStore(id, youtubeSong); !loaded {
+		youtubeDB.songsRanking.insert(youtubeSong.rankingKey())
+	}
+}
+
+// TestEvictWhileFetching is meant for go test -race
+func TestEvictWhileFetching(t *testing.T) {
+	// Songs fetched after their eviction have to ask youtube again, let that fail
+	transport := http.DefaultTransport
+	http.DefaultTransport = offlineTransport{}
+	defer func() { http.DefaultTransport = transport }()
+
+	dir, err := ioutil.TempDir("", "ytfetcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	youtubeDB := newTestYoutubeDB()
+	ids := []string{"aaaaaaaaaaa", "bbbbbbbbbbb", "ccccccccccc"}
+	for _, id := range ids {
+		addDownloadedSong(t, youtubeDB, dir, id)
+	}
+
+	var wait sync.WaitGroup
+	for _, id := range ids {
+		for i := 0; i < 4; i++ {
+			wait.Add(1)
+			go func(id string) {
+				defer wait.Done()
+				for j := 0; j < 50; j++ {
+					youtubeDB.FetchYoutubeSong(id)
+				}
+			}(id)
+		}
+		wait.Add(1)
+		go func(id string) {
+			defer wait.Done()
+			for j := 0; j < 50; j++ {
+				youtubeDB.EvictYoutubeSong(id)
+				addDownloadedSong(t, youtubeDB, dir, id)
+			}
+		}(id)
+	}
+	wait.Wait()
+
+	// Every song has exactly one ranking entry, evicted ones none
+	songs := 0
+	youtubeDB.songs.Range(func(key, value interface{}) bool {
+		songs++
+		return true
+	})
+	if size := youtubeDB.songsRanking.getSize(); size != songs {
+		t.Errorf("%d ranking entries for %d songs", size, songs)
+	}
+	for youtubeDB.songsRanking.getSize() > 0 {
+		lowest := youtubeDB.songsRanking.getLowest()
+		if _, ok := youtubeDB.songs.Load(lowest.GetUniqueId()); !ok {
+			t.Errorf("ranking entry of evicted song %s", lowest.GetUniqueId())
+		}
+		youtubeDB.songsRanking.delete(lowest)
+	}
+}
+
+func TestEvictWhileSearching(t *testing.T) {
+	youtubeDB := newTestYoutubeDB()
+	youtubeSearch := newYoutubeSearch("never gonna give you up")
+	youtubeDB.searches.Store(youtubeSearch.query, youtubeSearch)
+	youtubeDB.searchesRanking.insert(youtubeSearch.rankingKey())
+
+	var wait sync.WaitGroup
+	wait.Add(2)
+	go func() {
+		defer wait.Done()
+		for i := 0; i < 100; i++ {
+			youtubeSearch.increaseCount()
+		}
+	}()
+	go func() {
+		defer wait.Done()
+		youtubeDB.EvictYoutubeSearch(youtubeSearch.query)
+	}()
+	wait.Wait()
+
+	if _, ok := youtubeDB.searches.Load(youtubeSearch.query); ok {
+		t.Error("search wasn't evicted")
+	}
+}
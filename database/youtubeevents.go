@@ -0,0 +1,64 @@
+package database
+
+import (
+	"sync"
+)
+
+const (
+	SongQueued      = "queued"
+	SongDownloading = "downloading"
+	SongDownloaded  = "downloaded"
+	SongFailed      = "failed"
+	SongEvicted     = "evicted"
+)
+
+// Events which don't fit into a slow subscriber's buffer are dropped
+const songEventBuffer = 64
+
+// YoutubeSongEvent describes a change of the local copy of a song,
+// FetchId is the id returned by youtube/fetch in the ytfetcher-id header
+type YoutubeSongEvent struct {
+	Id       string  `json:"id"`
+	FetchId  string  `json:"fetchid"`
+	State    string  `json:"state"`
+	Progress float64 `json:"progress,omitempty"`
+	Reason   string  `json:"reason,omitempty"`
+}
+
+type songEventBroker struct {
+	subscribers map[chan YoutubeSongEvent]struct{}
+	lock        sync.Mutex
+}
+
+func newSongEventBroker() *songEventBroker {
+	return &songEventBroker{subscribers: make(map[chan YoutubeSongEvent]struct{})}
+}
+
+func (broker *songEventBroker) subscribe() (<-chan YoutubeSongEvent, func()) {
+	events := make(chan YoutubeSongEvent, songEventBuffer)
+
+	broker.lock.Lock()
+	broker.subscribers[events] = struct{}{}
+	broker.lock.Unlock()
+
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			broker.lock.Lock()
+			delete(broker.subscribers, events)
+			broker.lock.Unlock()
+			close(events)
+		})
+	}
+}
+
+func (broker *songEventBroker) publish(event YoutubeSongEvent) {
+	broker.lock.Lock()
+	defer broker.lock.Unlock()
+	for events := range broker.subscribers {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
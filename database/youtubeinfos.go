@@ -0,0 +1,68 @@
+package database
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/Grarak/GoYTFetcher/utils"
+)
+
+// MaxYoutubeInfos is the most ids a single batch may contain
+const MaxYoutubeInfos = 100
+
+// Cache misses of a batch resolved at the same time, each one spawns youtube-dl
+const youtubeInfosWorkers = 4
+
+// YoutubeInfo is the outcome of one id of a batch,
+// Info is only set if StatusCode is StatusNoError
+type YoutubeInfo struct {
+	Id         string               `json:"id"`
+	Info       *YoutubeSearchResult `json:"info,omitempty"`
+	StatusCode int                  `json:"statuscode"`
+}
+
+// GetYoutubeInfos resolves ids like GetYoutubeInfo, the infos are in the
+// order of ids and a failing id doesn't affect the others
+func (youtubeDB *youtubeDBImpl) GetYoutubeInfos(ids []string) []YoutubeInfo {
+	infos := make([]YoutubeInfo, len(ids))
+
+	// Duplicates are only resolved once
+	first := make(map[string]int)
+	jobs := make(chan int, len(ids))
+	for i, id := range ids {
+		id = strings.TrimSpace(id)
+		infos[i].Id = id
+		if _, ok := first[id]; !ok {
+			first[id] = i
+			jobs <- i
+		}
+	}
+	close(jobs)
+
+	workers := youtubeInfosWorkers
+	if len(first) < workers {
+		workers = len(first)
+	}
+	var wait sync.WaitGroup
+	wait.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wait.Done()
+			for job := range jobs {
+				infos[job].StatusCode = utils.StatusYoutubeGetInfoFailure
+				if utils.StringIsEmpty(infos[job].Id) {
+					infos[job].StatusCode = utils.StatusInvalid
+				} else if result, err := youtubeDB.GetYoutubeInfo(infos[job].Id); err == nil {
+					infos[job].Info = &result
+					infos[job].StatusCode = utils.StatusNoError
+				}
+			}
+		}()
+	}
+	wait.Wait()
+
+	for i := range infos {
+		infos[i] = infos[first[infos[i].Id]]
+	}
+	return infos
+}
@@ -66,16 +66,21 @@ func (youtubeSearch *YoutubeSearch) search(youtubeDB *youtubeDBImpl) ([]YoutubeS
 	youtubeSearch.rwLock.Lock()
 	defer youtubeSearch.rwLock.Unlock()
 
+	backend := "website"
 	results, err := youtubeSearch.getSearchFromWebsite(youtubeDB)
 	if err != nil && !utils.StringIsEmpty(youtubeDB.ytKey) {
+		backend = "api"
 		results, err = youtubeSearch.getSearchFromApi(youtubeDB)
 	}
 	if err != nil {
+		backend = "youtube-dl"
 		results, err = youtubeSearch.getSearchFromYoutubeDL(youtubeDB)
 	}
 	if err != nil {
+		searchBackends.Inc("none")
 		return nil, err
 	}
+	searchBackends.Inc(backend)
 	youtubeSearch.results = results
 	return results, err
 }
@@ -279,6 +284,13 @@ func (youtubeSearch *YoutubeSearch) increaseCount() {
 	youtubeSearch.count++
 }
 
+// rankingKey is what searchesRanking holds of the search
+func (youtubeSearch *YoutubeSearch) rankingKey() rankingKey {
+	youtubeSearch.valuesLock.RLock()
+	defer youtubeSearch.valuesLock.RUnlock()
+	return rankingKey{youtubeSearch.query, youtubeSearch.count}
+}
+
 func (youtubeSearch YoutubeSearch) GetUniqueId() string {
 	return youtubeSearch.query
 }
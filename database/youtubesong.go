@@ -2,8 +2,14 @@ package database
 
 import (
 	"crypto/aes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
 	"sync"
 	"time"
 
@@ -14,6 +20,32 @@ import (
 	"github.com/Grarak/GoYTFetcher/ytdl"
 )
 
+// videoIdRegex matches the ids youtube gives videos, nothing else
+// may end up in file names or the patterns removing them
+var videoIdRegex = regexp.MustCompile("^[a-z_A-Z0-9\\-]{11}$")
+
+var ErrInvalidVideoId = errors.New("invalid video id")
+
+// MaxDownloadDuration is the longest video which is downloaded,
+// longer ones are only streamed with the smallest audio format
+const MaxDownloadDuration = 20 * time.Minute
+
+// AudioFormat describes audio clients receive, Bitrate is in kb/s
+type AudioFormat struct {
+	Source    string `json:"source"`
+	Container string `json:"container"`
+	Codec     string `json:"codec"`
+	Bitrate   int    `json:"bitrate,omitempty"`
+}
+
+// AudioFormats lists the downloaded file, the googlevideo link of videos
+// up to MaxDownloadDuration and the one of longer videos
+var AudioFormats = []AudioFormat{
+	{"file", "ogg", "vorbis", 160},
+	{"stream", "webm", "vorbis", 0},
+	{"stream-long", "webm", "opus", 0},
+}
+
 type YoutubeSong struct {
 	id string
 
@@ -21,6 +53,7 @@ type YoutubeSong struct {
 	downloadUrlTime time.Time
 
 	count       int
+	lastAccess  time.Time
 	downloaded  bool
 	downloading bool
 
@@ -42,7 +75,19 @@ type YoutubeSongReader struct {
 }
 
 func newYoutubeSong(id string) *YoutubeSong {
-	return &YoutubeSong{id: id, count: 1}
+	return &YoutubeSong{id: id, count: 1, lastAccess: time.Now()}
+}
+
+func (youtubeSong *YoutubeSong) getLastAccess() time.Time {
+	youtubeSong.stateLock.RLock()
+	defer youtubeSong.stateLock.RUnlock()
+	return youtubeSong.lastAccess
+}
+
+func (youtubeSong *YoutubeSong) setLastAccess(lastAccess time.Time) {
+	youtubeSong.stateLock.Lock()
+	defer youtubeSong.stateLock.Unlock()
+	youtubeSong.lastAccess = lastAccess
 }
 
 func (youtubeSong *YoutubeSong) isDownloaded() bool {
@@ -70,6 +115,7 @@ func (youtubeSong *YoutubeSong) setDownloading(downloading bool) {
 }
 
 func (youtubeSong *YoutubeSong) Reader() (*YoutubeSongReader, error) {
+	youtubeSong.setLastAccess(time.Now())
 	youtubeSong.readLock.RLock()
 	defer youtubeSong.readLock.RUnlock()
 	file, err := os.Open(youtubeSong.filePath)
@@ -93,7 +139,7 @@ func (youtubeSong *YoutubeSong) getDownloadUrl() (string, error) {
 	}
 
 	var link *url.URL
-	if info.VideoInfo.Duration.Minutes() <= 20 {
+	if info.VideoInfo.Duration <= MaxDownloadDuration {
 		link, err = info.GetDownloadURL()
 	} else {
 		link, err = info.GetDownloadURLWorst()
@@ -108,38 +154,80 @@ func (youtubeSong *YoutubeSong) getDownloadUrl() (string, error) {
 	return youtubeSong.downloadUrl, nil
 }
 
+// RefreshDownloadUrl resolves a new googlevideo url,
+// the cached one is dropped as the upstream rejected it
+func (youtubeSong *YoutubeSong) RefreshDownloadUrl() (string, error) {
+	youtubeSong.songLock.Lock()
+	defer youtubeSong.songLock.Unlock()
+
+	youtubeSong.downloadUrl = ""
+	return youtubeSong.getDownloadUrl()
+}
+
 func (youtubeSong *YoutubeSong) download(youtubeDB *youtubeDBImpl) error {
 	youtubeSong.setDownloading(true)
 
 	info, err := ytdl.GetVideoDownloadInfo(youtubeSong.id)
 	if err != nil {
 		youtubeSong.setDownloading(false)
+		youtubeDB.recordExtraction(err)
+		youtubeDB.publishSongEvent(youtubeSong, SongFailed, 0, "video info unavailable")
 		return err
 	}
 
-	if info.VideoInfo.Duration.Minutes() <= 20 {
+	if info.VideoInfo.Duration <= MaxDownloadDuration {
 		logger.I("Downloading " + info.VideoInfo.Title)
 		defer logger.I("Finished downloading " + info.VideoInfo.Title)
 
 		defer youtubeSong.setDownloading(false)
 
-		path, err := info.VideoInfo.Download(utils.YOUTUBE_DIR, youtubeDB.youtubeDL)
+		youtubeDB.publishSongEvent(youtubeSong, SongDownloading, 0, "")
+		lastProgress := 0
+		path, err := info.VideoInfo.Download(youtubeDB.downloadCtx,
+			utils.YOUTUBE_DIR, youtubeDB.youtubeDL, func(percent float64) {
+				// Whole percents are enough for clients
+				if int(percent) > lastProgress {
+					lastProgress = int(percent)
+					youtubeDB.publishSongEvent(youtubeSong, SongDownloading, percent, "")
+				}
+			})
+		if youtubeDB.downloadCtx.Err() == nil {
+			// Downloads cancelled by the shutdown say nothing about youtube-dl
+			youtubeDB.recordExtraction(err)
+		}
 		if err != nil {
+			youtubeSong.removePartialFiles()
+			youtubeDB.publishSongEvent(youtubeSong, SongFailed, 0, "download failed")
 			return err
 		}
 		youtubeSong.filePath = path
 
 		if youtubeSong.deleted {
 			os.Remove(youtubeSong.filePath)
+			youtubeDB.publishSongEvent(youtubeSong, SongEvicted, 0, "")
 		} else {
-			defer youtubeSong.setDownloaded(true)
+			youtubeSong.setDownloaded(true)
+			youtubeDB.publishSongEvent(youtubeSong, SongDownloaded, 100, "")
 		}
 		return nil
 	}
 	logger.I(info.VideoInfo.Title + " is too long, skipping download")
+	youtubeDB.publishSongEvent(youtubeSong, SongFailed, 0, "too long")
 	return nil
 }
 
+// removePartialFiles cleans up what youtube-dl left behind
+// after an interrupted or failed download
+func (youtubeSong *YoutubeSong) removePartialFiles() {
+	files, err := filepath.Glob(utils.YOUTUBE_DIR + "/" + youtubeSong.id + ".*")
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		os.Remove(file)
+	}
+}
+
 func (youtubeSong *YoutubeSong) delete() {
 	youtubeSong.readLock.Lock()
 	defer youtubeSong.readLock.Unlock()
@@ -150,6 +238,32 @@ func (youtubeSong *YoutubeSong) delete() {
 	}
 }
 
+// removeFile drops the downloaded file, the song stays known
+func (youtubeSong *YoutubeSong) removeFile() {
+	youtubeSong.readLock.Lock()
+	defer youtubeSong.readLock.Unlock()
+
+	if youtubeSong.isDownloaded() {
+		os.Remove(youtubeSong.filePath)
+		youtubeSong.setDownloaded(false)
+	}
+}
+
+// fileSize is 0 as long as the song isn't downloaded
+func (youtubeSong *YoutubeSong) fileSize() int64 {
+	youtubeSong.readLock.RLock()
+	defer youtubeSong.readLock.RUnlock()
+
+	if !youtubeSong.isDownloaded() {
+		return 0
+	}
+	info, err := os.Stat(youtubeSong.filePath)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
 func (youtubeSong *YoutubeSong) getEncryptedId(key []byte) string {
 	if utils.StringIsEmpty(youtubeSong.encryptedId) {
 		id := youtubeSong.id
@@ -165,6 +279,20 @@ func (youtubeSong *YoutubeSong) increaseCount() {
 	youtubeSong.stateLock.Lock()
 	defer youtubeSong.stateLock.Unlock()
 	youtubeSong.count++
+	youtubeSong.lastAccess = time.Now()
+}
+
+// rankingKey is what songsRanking holds of the song
+func (youtubeSong *YoutubeSong) rankingKey() rankingKey {
+	youtubeSong.stateLock.RLock()
+	defer youtubeSong.stateLock.RUnlock()
+	return rankingKey{youtubeSong.id, youtubeSong.count}
+}
+
+func (youtubeSong *YoutubeSong) isDeleted() bool {
+	youtubeSong.readLock.RLock()
+	defer youtubeSong.readLock.RUnlock()
+	return youtubeSong.deleted
 }
 
 func (youtubeSong YoutubeSong) GetUniqueId() string {
@@ -196,3 +324,27 @@ func (youtubeSongReader *YoutubeSongReader) Close() error {
 	defer youtubeSongReader.song.readLock.RUnlock()
 	return youtubeSongReader.file.Close()
 }
+
+func (youtubeSongReader *YoutubeSongReader) ModTime() time.Time {
+	youtubeSongReader.song.readLock.RLock()
+	defer youtubeSongReader.song.readLock.RUnlock()
+	info, err := youtubeSongReader.file.Stat()
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// ETag is derived from the song file, so it stays the same
+// across requests until the song gets downloaded again
+func (youtubeSongReader *YoutubeSongReader) ETag() string {
+	youtubeSongReader.song.readLock.RLock()
+	defer youtubeSongReader.song.readLock.RUnlock()
+	info, err := youtubeSongReader.file.Stat()
+	if err != nil {
+		return ""
+	}
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s-%d-%d",
+		youtubeSongReader.song.id, info.Size(), info.ModTime().UnixNano())))
+	return "\"" + hex.EncodeToString(hash[:16]) + "\""
+}
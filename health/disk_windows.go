@@ -0,0 +1,9 @@
+package health
+
+import (
+	"fmt"
+)
+
+func freeDiskSpace(dir string) (uint64, error) {
+	return 0, fmt.Errorf("free disk space can't be determined on windows")
+}
@@ -0,0 +1,108 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Grarak/GoYTFetcher/utils"
+)
+
+const (
+	StatusOk   = "ok"
+	StatusFail = "fail"
+)
+
+// Check probes a single dependency, it has to give up once ctx is done
+type Check func(ctx context.Context) error
+
+type CheckResult struct {
+	Status   string  `json:"status"`
+	Error    string  `json:"error,omitempty"`
+	Duration float64 `json:"duration_ms"`
+}
+
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// Run executes all checks in parallel, the report only
+// succeeds if every single check did
+func Run(ctx context.Context, checks map[string]Check) Report {
+	report := Report{Status: StatusOk, Checks: make(map[string]CheckResult)}
+
+	var lock sync.Mutex
+	var wait sync.WaitGroup
+	for name, check := range checks {
+		wait.Add(1)
+		go func(name string, check Check) {
+			defer wait.Done()
+
+			start := time.Now()
+			err := check(ctx)
+			result := CheckResult{
+				Status:   StatusOk,
+				Duration: float64(time.Since(start)) / float64(time.Millisecond),
+			}
+			if err != nil {
+				result.Status = StatusFail
+				result.Error = err.Error()
+			}
+
+			lock.Lock()
+			defer lock.Unlock()
+			report.Checks[name] = result
+			if err != nil {
+				report.Status = StatusFail
+			}
+		}(name, check)
+	}
+	wait.Wait()
+	return report
+}
+
+// YoutubeDL makes sure the youtube-dl binary still runs
+func YoutubeDL(ctx context.Context) error {
+	youtubeDL, err := exec.LookPath(utils.YOUTUBE_DL)
+	if err != nil {
+		return fmt.Errorf("%s is not installed", utils.YOUTUBE_DL)
+	}
+	if _, err := utils.ExecuteCmdContext(ctx, nil, youtubeDL, "--version"); err != nil {
+		return fmt.Errorf("%s doesn't run %s", utils.YOUTUBE_DL, err)
+	}
+	return nil
+}
+
+// Ffmpeg makes sure ffmpeg runs and can encode vorbis
+func Ffmpeg(ctx context.Context) error {
+	ffmpeg, err := exec.LookPath(utils.FFMPEG)
+	if err != nil {
+		return fmt.Errorf("%s is not installed", utils.FFMPEG)
+	}
+	codecs, err := utils.ExecuteCmdContext(ctx, nil, ffmpeg, "-codecs")
+	if err != nil {
+		return fmt.Errorf("%s doesn't run %s", utils.FFMPEG, err)
+	}
+	if !strings.Contains(codecs, "libvorbis") {
+		return fmt.Errorf("%s vorbis is not enabled", utils.FFMPEG)
+	}
+	return nil
+}
+
+// FreeDisk fails once less than minFree bytes are left on the disk of dir
+func FreeDisk(dir string, minFree uint64) Check {
+	return func(ctx context.Context) error {
+		free, err := freeDiskSpace(dir)
+		if err != nil {
+			return err
+		}
+		if free < minFree {
+			return fmt.Errorf("only %d bytes left in %s", free, dir)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,85 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/Grarak/GoYTFetcher/utils"
+)
+
+// RotatingFile appends to dir/prefix.txt, once the file exceeds maxSize
+// it's moved to prefix0.txt and older files shift up until maxFiles,
+// both the log and the access log are written through it
+type RotatingFile struct {
+	dir, prefix string
+	maxSize     int64
+	maxFiles    int
+	file        *os.File
+	lock        sync.Mutex
+}
+
+func NewRotatingFile(dir, prefix string, maxSize int64, maxFiles int) (*RotatingFile, error) {
+	rotatingFile := &RotatingFile{dir: dir, prefix: prefix, maxSize: maxSize, maxFiles: maxFiles}
+	if err := rotatingFile.open(); err != nil {
+		return nil, err
+	}
+	return rotatingFile, nil
+}
+
+func (rotatingFile *RotatingFile) path(count int) string {
+	if count < 0 {
+		return fmt.Sprintf("%s/%s%s", rotatingFile.dir, rotatingFile.prefix, utils.LOG_EXTENSION)
+	}
+	return fmt.Sprintf("%s/%s%d%s", rotatingFile.dir, rotatingFile.prefix, count, utils.LOG_EXTENSION)
+}
+
+func (rotatingFile *RotatingFile) open() error {
+	if err := os.MkdirAll(rotatingFile.dir, os.ModePerm); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(rotatingFile.path(-1),
+		os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	rotatingFile.file = file
+	return nil
+}
+
+func (rotatingFile *RotatingFile) Write(p []byte) (int, error) {
+	rotatingFile.lock.Lock()
+	defer rotatingFile.lock.Unlock()
+
+	n, err := rotatingFile.file.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	info, err := rotatingFile.file.Stat()
+	if err == nil && info.Size() >= rotatingFile.maxSize {
+		err = rotatingFile.rotate()
+	}
+	return n, err
+}
+
+func (rotatingFile *RotatingFile) rotate() error {
+	rotatingFile.file.Close()
+
+	os.Remove(rotatingFile.path(rotatingFile.maxFiles - 1))
+	for i := rotatingFile.maxFiles - 2; i >= 0; i-- {
+		if _, err := os.Stat(rotatingFile.path(i)); err == nil {
+			os.Rename(rotatingFile.path(i), rotatingFile.path(i+1))
+		}
+	}
+	if err := os.Rename(rotatingFile.path(-1), rotatingFile.path(0)); err != nil {
+		return err
+	}
+	return rotatingFile.open()
+}
+
+func (rotatingFile *RotatingFile) Close() error {
+	rotatingFile.lock.Lock()
+	defer rotatingFile.lock.Unlock()
+	return rotatingFile.file.Close()
+}
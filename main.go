@@ -1,96 +1,249 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
-	"os/exec"
 	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/Grarak/GoYTFetcher/api"
+	"github.com/Grarak/GoYTFetcher/api/middleware"
 	"github.com/Grarak/GoYTFetcher/database"
+	"github.com/Grarak/GoYTFetcher/health"
 	"github.com/Grarak/GoYTFetcher/logger"
 	"github.com/Grarak/GoYTFetcher/miniserver"
 	"github.com/Grarak/GoYTFetcher/utils"
 )
 
-var indexDir string
-
-func clientHandler(client *miniserver.Client) miniserver.Response {
-	args := strings.Split(client.Url, "/")[1:]
-	if len(args) >= 3 && args[0] == "api" {
-		return api.GetResponse(args[1], args[2], args[3:], client)
-	}
-
-	if !utils.StringIsEmpty(indexDir) {
-		if client.Url != "/" && utils.FileExists(indexDir+client.Url) {
-			return client.ResponseFile(indexDir + client.Url)
-		}
-		if utils.FileExists(indexDir + "/index.html") {
-			return client.ResponseFile(indexDir + "/index.html")
+func notFoundHandler(static miniserver.Handler) miniserver.Handler {
+	return func(client *miniserver.Client) miniserver.Response {
+		if static == nil || strings.HasPrefix(client.Url, "/api/") {
+			return client.ResponseNotFound()
 		}
+		return static(client)
 	}
-
-	response := client.ResponseBody("Not found")
-	response.SetStatusCode(http.StatusNotFound)
-	return response
 }
 
 func main() {
 	logger.Init()
 
-	if _, err := exec.LookPath(utils.YOUTUBE_DL); err != nil {
-		logger.E(utils.YOUTUBE_DL + " is not installed!")
+	if err := health.YoutubeDL(context.Background()); err != nil {
+		logger.E(err)
 		return
 	}
-
-	ffmpeg, err := exec.LookPath(utils.FFMPEG)
-	if err != nil {
-		logger.E(utils.FFMPEG + " is not installed!")
-		return
-	}
-
-	codecs, err := utils.ExecuteCmd(ffmpeg, "-codecs")
-	if err != nil || !strings.Contains(codecs, "libvorbis") {
-		logger.E(utils.FFMPEG + " vorbis is not enabled")
+	if err := health.Ffmpeg(context.Background()); err != nil {
+		logger.E(err)
 		return
 	}
 
 	var port int
 	var ytKey string
+	var indexDir, spaFallback string
+	var directoryIndex bool
+	var tlsCert, tlsKey string
+	var redirectPort int
+	var shutdownTimeout time.Duration
+	var trustedProxies string
+	var maxBodySize int64
+	var timeouts miniserver.Timeouts
+	var accessLogFormat string
+	var listenAddresses, unixMode, unixGroup string
+	var enableMetrics bool
+	var apiDocs bool
+	var minFreeDisk uint64
+	var corsOrigins string
+	var corsCredentials bool
+	var corsMaxAge time.Duration
+	var signupPolicy string
+	rateLimits := map[string]*string{}
 	flag.IntVar(&port, "p", 6713, "Which port to use")
+	flag.StringVar(&listenAddresses, "listen", "",
+		"Comma separated addresses like 127.0.0.1:6714, unix:/path/to/socket or systemd, replaces -p")
+	flag.StringVar(&unixMode, "unix-mode", "0660", "Octal permissions of unix sockets")
+	flag.StringVar(&unixGroup, "unix-group", "", "Group owning the unix sockets")
 	flag.StringVar(&ytKey, "yt", "", "Youtube Api key")
 	flag.StringVar(&indexDir, "i", "", "Directory with index.html")
+	flag.StringVar(&spaFallback, "spa-fallback", "index.html",
+		"File served for unknown paths of the web page, empty to disable")
+	flag.BoolVar(&directoryIndex, "dir-index", true,
+		"Serve index.html when a directory of the web page is requested")
+	flag.StringVar(&tlsCert, "tls-cert", "", "Certificate file, enables HTTPS")
+	flag.StringVar(&tlsKey, "tls-key", "", "Private key file of the certificate")
+	flag.IntVar(&redirectPort, "tls-redirect", 0, "Port which redirects HTTP to HTTPS")
+	flag.StringVar(&trustedProxies, "trusted-proxies", "",
+		"Comma separated CIDRs of proxies whose forwarding headers are trusted")
+	flag.Int64Var(&maxBodySize, "max-body", miniserver.DefaultMaxBodySize,
+		"Default limit in bytes for request bodies")
+	flag.DurationVar(&timeouts.ReadHeader, "read-header-timeout", 10*time.Second,
+		"How long clients may take to send the request headers")
+	flag.DurationVar(&timeouts.Read, "read-timeout", 30*time.Second,
+		"How long clients may take to send the whole request")
+	flag.DurationVar(&timeouts.Idle, "idle-timeout", 2*time.Minute,
+		"How long idle keep-alive connections are kept open")
+	flag.StringVar(&accessLogFormat, "access-log", "",
+		"Write an access log in combined or json format, empty to disable")
+	flag.StringVar(&corsOrigins, "cors-origins", "",
+		"Comma separated origins allowed to use the api from a browser, * for any")
+	flag.BoolVar(&corsCredentials, "cors-credentials", false,
+		"Allow browsers to send cookies and authorization to the api")
+	flag.DurationVar(&corsMaxAge, "cors-max-age", 10*time.Minute,
+		"How long browsers may cache preflight responses")
+	flag.Uint64Var(&minFreeDisk, "min-free-disk", 512*1024*1024,
+		"Bytes which have to be free for downloads, /readyz fails below")
+	flag.StringVar(&signupPolicy, "signup", database.SignupInvite,
+		"Who may sign up: open, invite (an admin verifies new users) or closed")
+	flag.BoolVar(&enableMetrics, "metrics", false, "Expose prometheus metrics on /metrics")
+	flag.BoolVar(&apiDocs, "api-docs", false, "Serve a viewer of /api/openapi.json on /api/docs")
+	flag.DurationVar(&shutdownTimeout, "shutdown-timeout", 30*time.Second,
+		"How long to wait for requests and downloads on shutdown")
+	rateLimits[middleware.LimitAuth] = flag.String("rate-auth", "10/1m",
+		"Allowed signups and logins per ip and user, 0 to disable")
+	rateLimits[middleware.LimitSearch] = flag.String("rate-search", "30/1m",
+		"Allowed searches and info requests per ip and user, 0 to disable")
+	rateLimits[middleware.LimitFetch] = flag.String("rate-fetch", "30/1m",
+		"Allowed fetches per ip and user, 0 to disable")
+	rateLimits[middleware.LimitGet] = flag.String("rate-get", "600/1m",
+		"Allowed audio requests per ip, 0 to disable")
 	flag.Parse()
 
+	for group, text := range rateLimits {
+		limit, err := miniserver.ParseRateLimit(*text)
+		if err != nil {
+			logger.E(err)
+			return
+		}
+		middleware.SetRateLimit(group, limit)
+	}
+
 	utils.Panic(utils.MkDir(utils.DATABASE))
 	utils.Panic(utils.MkDir(utils.YOUTUBE_DIR))
 
 	databaseInstance := database.GetDatabase(utils.GenerateRandom(16), ytKey)
+	if err := databaseInstance.UsersDB.SetSignupPolicy(signupPolicy); err != nil {
+		logger.E(err)
+		return
+	}
+
+	var static miniserver.Handler
+	if !utils.StringIsEmpty(indexDir) {
+		var err error
+		static, err = miniserver.NewStaticHandler(miniserver.StaticOptions{
+			Dir:            indexDir,
+			SpaFallback:    spaFallback,
+			DirectoryIndex: directoryIndex,
+		})
+		if err != nil {
+			logger.E(fmt.Sprintf("Can't serve %s %s", indexDir, err))
+			return
+		}
+	}
+
+	router := miniserver.NewRouter()
+	router.Use(miniserver.Recovery)
+	if !utils.StringIsEmpty(corsOrigins) {
+		policy := miniserver.NewCorsPolicy(strings.Split(corsOrigins, ","))
+		policy.AllowCredentials = corsCredentials
+		policy.MaxAge = corsMaxAge
+		if err := policy.Validate(); err != nil {
+			logger.E(err)
+			return
+		}
+		router.Use(miniserver.Cors(policy))
+	}
+	router.NotFound(notFoundHandler(static))
+	router.SetMaxBodySize(maxBodySize)
+	api.RegisterRoutes(router)
+	api.RegisterOpenApi(router, apiDocs)
+	api.RegisterHealth(router, map[string]health.Check{
+		"sqlite":          databaseInstance.CheckWritable,
+		"youtube-dl":      health.YoutubeDL,
+		"ffmpeg":          health.Ffmpeg,
+		"disk":            health.FreeDisk(utils.YOUTUBE_DIR, minFreeDisk),
+		"last-extraction": databaseInstance.CheckLastExtraction,
+	})
+	if enableMetrics {
+		router.Handle(http.MethodGet, "/metrics", middleware.Metrics)
+	}
+
+	proxies, err := miniserver.ParseTrustedProxies(trustedProxies)
+	if err != nil {
+		logger.E(err)
+		return
+	}
 
 	server := miniserver.NewServer(port)
+	server.SetTrustedProxies(proxies)
+	server.SetTimeouts(timeouts)
+	if enableMetrics {
+		server.SetRequestObserver(middleware.ObserveRequest)
+	}
+	for _, address := range strings.Split(listenAddresses, ",") {
+		if address = strings.TrimSpace(address); !utils.StringIsEmpty(address) {
+			server.AddListenAddress(address)
+		}
+	}
+	mode, err := strconv.ParseUint(unixMode, 8, 32)
+	if err != nil {
+		logger.E(fmt.Sprintf("Invalid unix socket mode %s", unixMode))
+		return
+	}
+	server.SetUnixSocketPermissions(os.FileMode(mode), unixGroup)
+	if !utils.StringIsEmpty(accessLogFormat) {
+		accessLogFile, err := logger.NewRotatingFile(utils.LOG_DIR, utils.ACCESS_LOG_PREFIX,
+			logger.LogFileSize, logger.LogFilesLimit)
+		if err != nil {
+			logger.E(fmt.Sprintf("Failed to open access log %s", err))
+			return
+		}
+		defer accessLogFile.Close()
+
+		accessLog, err := miniserver.NewAccessLog(accessLogFile, accessLogFormat)
+		if err != nil {
+			logger.E(err)
+			return
+		}
+		server.SetAccessLog(accessLog)
+	}
+	if !utils.StringIsEmpty(tlsCert) || !utils.StringIsEmpty(tlsKey) {
+		if err := server.EnableTLS(tlsCert, tlsKey); err != nil {
+			logger.E(fmt.Sprintf("Failed to load certificate %s", err))
+			return
+		}
+		if redirectPort > 0 {
+			server.EnableRedirect(redirectPort)
+		}
+	}
 
 	c := make(chan os.Signal, 1)
 	cleanup := make(chan bool)
-	signal.Notify(c, os.Interrupt)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
-		for sig := range c {
-			logger.I(fmt.Sprintf("Captured %s, killing...", sig))
-			server.StopListening()
-
-			if err := databaseInstance.Close(); err != nil {
-				logger.E(fmt.Sprintf("Failed to close database %s", err))
-			}
+		sig := <-c
+		logger.I(fmt.Sprintf("Captured %s, shutting down...", sig))
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
 
-			cleanup <- true
+		if err := server.Shutdown(ctx); err != nil {
+			logger.E(fmt.Sprintf("Failed to drain requests %s", err))
+		}
+		if err := databaseInstance.YoutubeDB.Shutdown(ctx); err != nil {
+			logger.E(fmt.Sprintf("Cancelled active downloads %s", err))
 		}
+		if err := databaseInstance.Close(); err != nil {
+			logger.E(fmt.Sprintf("Failed to close database %s", err))
+		}
+
+		cleanup <- true
 	}()
 
-	logger.I("Starting server on port " + strconv.Itoa(port))
-	go server.StartListening(clientHandler)
+	logger.I("Starting server")
+	go server.StartListening(router.ServeClient)
 
 	<-cleanup
 }
@@ -0,0 +1,273 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType of the prometheus text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets fit request latencies in seconds
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type metric interface {
+	write(writer *bufio.Writer)
+}
+
+var registryLock sync.Mutex
+var registry []metric
+var scrapeHooks []func()
+
+func register(m metric) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	registry = append(registry, m)
+}
+
+// OnScrape runs hook before every scrape, gauges which
+// are expensive to keep up to date can be set there
+func OnScrape(hook func()) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	scrapeHooks = append(scrapeHooks, hook)
+}
+
+// Write outputs all metrics in the prometheus text format
+func Write(writer io.Writer) error {
+	registryLock.Lock()
+	hooks := scrapeHooks
+	metrics := registry
+	registryLock.Unlock()
+
+	for _, hook := range hooks {
+		hook()
+	}
+
+	bufWriter := bufio.NewWriter(writer)
+	for _, m := range metrics {
+		m.write(bufWriter)
+	}
+	return bufWriter.Flush()
+}
+
+type desc struct {
+	name, help, kind string
+	labelNames       []string
+}
+
+func (d desc) writeHeader(writer *bufio.Writer) {
+	fmt.Fprintf(writer, "# HELP %s %s\n", d.name, strings.Replace(d.help, "\n", " ", -1))
+	fmt.Fprintf(writer, "# TYPE %s %s\n", d.name, d.kind)
+}
+
+// labels formats the label pairs, extra is appended as is
+func (d desc) labels(labelValues []string, extra string) string {
+	pairs := make([]string, 0, len(labelValues)+1)
+	for i, value := range labelValues {
+		pairs = append(pairs, d.labelNames[i]+"=\""+escapeLabel(value)+"\"")
+	}
+	if len(extra) > 0 {
+		pairs = append(pairs, extra)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func (d desc) key(labelValues []string) string {
+	if len(labelValues) != len(d.labelNames) {
+		panic(fmt.Sprintf("%s expects labels %v, got %v", d.name, d.labelNames, labelValues))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+func escapeLabel(value string) string {
+	value = strings.Replace(value, "\\", "\\\\", -1)
+	value = strings.Replace(value, "\"", "\\\"", -1)
+	return strings.Replace(value, "\n", "\\n", -1)
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// values holds one float per label combination
+type values struct {
+	desc
+	values map[string]float64
+	lock   sync.Mutex
+}
+
+func newValues(name, help, kind string, labelNames []string) *values {
+	return &values{desc: desc{name, help, kind, labelNames}, values: make(map[string]float64)}
+}
+
+func (v *values) add(delta float64, labelValues []string) {
+	key := v.key(labelValues)
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.values[key] += delta
+}
+
+func (v *values) set(value float64, labelValues []string) {
+	key := v.key(labelValues)
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.values[key] = value
+}
+
+func (v *values) write(writer *bufio.Writer) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	v.writeHeader(writer)
+	for _, key := range sortedKeys(v.values) {
+		fmt.Fprintf(writer, "%s%s %s\n", v.name,
+			v.labels(splitKey(key, len(v.labelNames)), ""), formatFloat(v.values[key]))
+	}
+}
+
+// Counter only goes up, like the number of handled requests
+type Counter struct {
+	*values
+}
+
+func NewCounter(name, help string, labelNames ...string) *Counter {
+	counter := &Counter{newValues(name, help, "counter", labelNames)}
+	register(counter)
+	return counter
+}
+
+func (counter *Counter) Inc(labelValues ...string) {
+	counter.add(1, labelValues)
+}
+
+func (counter *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic(counter.name + " can't decrease")
+	}
+	counter.add(delta, labelValues)
+}
+
+// Gauge can go up and down, like the number of active downloads
+type Gauge struct {
+	*values
+}
+
+func NewGauge(name, help string, labelNames ...string) *Gauge {
+	gauge := &Gauge{newValues(name, help, "gauge", labelNames)}
+	register(gauge)
+	return gauge
+}
+
+func (gauge *Gauge) Set(value float64, labelValues ...string) {
+	gauge.set(value, labelValues)
+}
+
+func (gauge *Gauge) Inc(labelValues ...string) {
+	gauge.add(1, labelValues)
+}
+
+func (gauge *Gauge) Dec(labelValues ...string) {
+	gauge.add(-1, labelValues)
+}
+
+type histogramValue struct {
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+// Histogram counts observations like latencies into buckets
+type Histogram struct {
+	desc
+	buckets []float64
+	values  map[string]*histogramValue
+	lock    sync.Mutex
+}
+
+func NewHistogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	histogram := &Histogram{
+		desc:    desc{name, help, "histogram", labelNames},
+		buckets: buckets,
+		values:  make(map[string]*histogramValue),
+	}
+	register(histogram)
+	return histogram
+}
+
+func (histogram *Histogram) Observe(value float64, labelValues ...string) {
+	key := histogram.key(labelValues)
+	histogram.lock.Lock()
+	defer histogram.lock.Unlock()
+
+	v, ok := histogram.values[key]
+	if !ok {
+		v = &histogramValue{buckets: make([]uint64, len(histogram.buckets))}
+		histogram.values[key] = v
+	}
+	for i, bound := range histogram.buckets {
+		if value <= bound {
+			v.buckets[i]++
+		}
+	}
+	v.count++
+	v.sum += value
+}
+
+func (histogram *Histogram) write(writer *bufio.Writer) {
+	histogram.lock.Lock()
+	defer histogram.lock.Unlock()
+
+	histogram.writeHeader(writer)
+	keys := make([]string, 0, len(histogram.values))
+	for key := range histogram.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		v := histogram.values[key]
+		labelValues := splitKey(key, len(histogram.labelNames))
+		for i, bound := range histogram.buckets {
+			fmt.Fprintf(writer, "%s_bucket%s %d\n", histogram.name,
+				histogram.labels(labelValues, "le=\""+formatFloat(bound)+"\""), v.buckets[i])
+		}
+		fmt.Fprintf(writer, "%s_bucket%s %d\n", histogram.name,
+			histogram.labels(labelValues, "le=\"+Inf\""), v.count)
+		fmt.Fprintf(writer, "%s_sum%s %s\n", histogram.name,
+			histogram.labels(labelValues, ""), formatFloat(v.sum))
+		fmt.Fprintf(writer, "%s_count%s %d\n", histogram.name,
+			histogram.labels(labelValues, ""), v.count)
+	}
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func splitKey(key string, count int) []string {
+	if count == 0 {
+		return nil
+	}
+	return strings.Split(key, "\xff")
+}
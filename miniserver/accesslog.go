@@ -0,0 +1,133 @@
+package miniserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Grarak/GoYTFetcher/utils"
+)
+
+const (
+	AccessLogCombined = "combined"
+	AccessLogJson     = "json"
+)
+
+// Query parameters which carry credentials and never end up in the log
+var redactedQueries = []string{"apikey", "key", "token"}
+
+type AccessLog struct {
+	writer io.Writer
+	format string
+}
+
+type accessLogEntry struct {
+	Time      time.Time `json:"time"`
+	IPAddr    string    `json:"ip"`
+	User      string    `json:"user,omitempty"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Protocol  string    `json:"protocol"`
+	Status    int       `json:"status"`
+	Size      int64     `json:"size"`
+	Duration  float64   `json:"duration_ms"`
+	Referer   string    `json:"referer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+}
+
+func NewAccessLog(writer io.Writer, format string) (*AccessLog, error) {
+	if format != AccessLogCombined && format != AccessLogJson {
+		return nil, fmt.Errorf("unknown access log format %s", format)
+	}
+	return &AccessLog{writer, format}, nil
+}
+
+func (accessLog *AccessLog) log(client *Client, request *http.Request,
+	recorder *responseRecorder, duration time.Duration) {
+	entry := accessLogEntry{
+		Time:      time.Now(),
+		IPAddr:    client.IPAddr,
+		User:      client.UserName,
+		Method:    client.Method,
+		Path:      redactedRequestUri(request.URL),
+		Protocol:  request.Proto,
+		Status:    recorder.status,
+		Size:      recorder.size,
+		Duration:  float64(duration) / float64(time.Millisecond),
+		Referer:   request.Referer(),
+		UserAgent: request.UserAgent(),
+	}
+
+	var line string
+	if accessLog.format == AccessLogJson {
+		b, err := json.Marshal(entry)
+		if err != nil {
+			return
+		}
+		line = string(b) + "\n"
+	} else {
+		line = entry.combined()
+	}
+	accessLog.writer.Write([]byte(line))
+}
+
+// combined formats the entry in Apache combined log format,
+// followed by the duration in milliseconds
+func (entry accessLogEntry) combined() string {
+	user := entry.User
+	if utils.StringIsEmpty(user) {
+		user = "-"
+	}
+	return fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %d %q %q %.3f\n",
+		entry.IPAddr, user, entry.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		entry.Method, entry.Path, entry.Protocol, entry.Status, entry.Size,
+		orDash(entry.Referer), orDash(entry.UserAgent), entry.Duration)
+}
+
+func orDash(text string) string {
+	if utils.StringIsEmpty(text) {
+		return "-"
+	}
+	return text
+}
+
+func redactedRequestUri(u *url.URL) string {
+	query := u.Query()
+	for key := range query {
+		if utils.StringArrayContains(redactedQueries, strings.ToLower(key)) {
+			query.Set(key, "REDACTED")
+		}
+	}
+	if len(query) == 0 {
+		return u.EscapedPath()
+	}
+	return u.EscapedPath() + "?" + query.Encode()
+}
+
+// responseRecorder remembers what was sent to the client
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (recorder *responseRecorder) WriteHeader(status int) {
+	recorder.status = status
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+func (recorder *responseRecorder) Write(p []byte) (int, error) {
+	n, err := recorder.ResponseWriter.Write(p)
+	recorder.size += int64(n)
+	return n, err
+}
+
+func (recorder *responseRecorder) Flush() {
+	if flusher, ok := recorder.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
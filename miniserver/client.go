@@ -1,41 +1,103 @@
 package miniserver
 
 import (
+	"context"
+	"errors"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
-
-	"github.com/Grarak/GoYTFetcher/utils"
 )
 
+var ErrBodyTooLarge = errors.New("request body too large")
+
 type Client struct {
 	Host, Url, Method, IPAddr string
-	Request                   []byte
-	Header                    http.Header
-	Queries                   url.Values
+	// Request holds the body, it's read once a route matched
+	Request []byte
+	Header  http.Header
+	Queries url.Values
+	Params  map[string]string
+	// Pattern of the matched route, empty if none matched
+	Pattern string
+	// UserName is set once the requester is known, for the access log
+	UserName string
+
+	ctx           context.Context
+	cookies       []*http.Cookie
+	body          io.Reader
+	contentLength int64
+	// closing is closed once the server shuts down
+	closing <-chan struct{}
 }
 
-func newClient(request *http.Request) *Client {
-	defer request.Body.Close()
+func newClient(request *http.Request, trustedProxies []*net.IPNet) *Client {
+	return &Client{
+		Host:          request.Host,
+		Url:           request.URL.Path,
+		Method:        request.Method,
+		IPAddr:        resolveClientIp(request, trustedProxies),
+		Header:        request.Header,
+		Queries:       request.URL.Query(),
+		Params:        make(map[string]string),
+		ctx:           request.Context(),
+		cookies:       request.Cookies(),
+		body:          request.Body,
+		contentLength: request.ContentLength,
+	}
+}
 
-	body, _ := ioutil.ReadAll(request.Body)
-	ipAddr := request.RemoteAddr[:strings.LastIndex(request.RemoteAddr, ":")]
-	if cfConnectionIP := request.Header.Get("Cf-Connecting-Ip"); !utils.StringIsEmpty(cfConnectionIP) {
-		ipAddr = cfConnectionIP
+// ReadBody reads the request body into Request,
+// bodies larger than limit are rejected with ErrBodyTooLarge
+func (client *Client) ReadBody(limit int64) error {
+	if client.body == nil {
+		return nil
 	}
+	reader := client.body
+	client.body = nil
 
-	return &Client{
-		request.Host,
-		request.URL.Path,
-		request.Method,
-		ipAddr,
-		body,
-		request.Header,
-		request.Form,
+	if client.contentLength > limit {
+		return ErrBodyTooLarge
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(reader, limit+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(body)) > limit {
+		return ErrBodyTooLarge
 	}
+	client.Request = body
+	return nil
 }
 
 func (client *Client) IsContentJson() bool {
 	return strings.HasPrefix(client.Header.Get("Content-Type"), ContentJson)
 }
+
+// Param returns the path parameter captured by the matched route pattern
+func (client *Client) Param(name string) string {
+	return client.Params[name]
+}
+
+// Cookie returns the value of the named request cookie, empty if it isn't set
+func (client *Client) Cookie(name string) string {
+	for _, cookie := range client.cookies {
+		if cookie.Name == name {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+// Context is done once the request is finished, it carries
+// the values middlewares attached with WithValue
+func (client *Client) Context() context.Context {
+	return client.ctx
+}
+
+// WithValue attaches a value to the context of the request
+func (client *Client) WithValue(key, value interface{}) {
+	client.ctx = context.WithValue(client.ctx, key, value)
+}
@@ -0,0 +1,135 @@
+package miniserver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/Grarak/GoYTFetcher/utils"
+)
+
+// ParseTrustedProxies parses a comma separated list of CIDRs,
+// single addresses are accepted as well
+func ParseTrustedProxies(text string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, entry := range strings.Split(text, ",") {
+		entry = strings.TrimSpace(entry)
+		if utils.StringIsEmpty(entry) {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %s", entry)
+			}
+			if ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %s", entry)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+func isTrustedProxy(trustedProxies []*net.IPNet, ip string) bool {
+	parsedIp := net.ParseIP(ip)
+	if parsedIp == nil {
+		return false
+	}
+	for _, network := range trustedProxies {
+		if network.Contains(parsedIp) {
+			return true
+		}
+	}
+	return false
+}
+
+// isUnixSocket tells whether the request came through a unix socket,
+// only a local proxy like nginx can connect there, so it's trusted
+func isUnixSocket(request *http.Request) bool {
+	addr, ok := request.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	return ok && addr.Network() == "unix"
+}
+
+// resolveClientIp returns the address of the peer, unless the peer
+// is a trusted proxy, then the forwarding headers are consulted
+func resolveClientIp(request *http.Request, trustedProxies []*net.IPNet) string {
+	peer := normalizeIp(request.RemoteAddr)
+	if utils.StringIsEmpty(peer) {
+		peer = request.RemoteAddr
+	}
+	if !isTrustedProxy(trustedProxies, peer) && !isUnixSocket(request) {
+		return peer
+	}
+
+	var chain []string
+	if forwarded := request.Header["Forwarded"]; len(forwarded) > 0 {
+		chain = parseForwarded(forwarded)
+	} else if forwardedFor := request.Header["X-Forwarded-For"]; len(forwardedFor) > 0 {
+		for _, value := range forwardedFor {
+			for _, ip := range strings.Split(value, ",") {
+				chain = append(chain, normalizeIp(ip))
+			}
+		}
+	} else if realIp := request.Header.Get("X-Real-Ip"); !utils.StringIsEmpty(realIp) {
+		chain = []string{normalizeIp(realIp)}
+	} else if cfConnectingIp := request.Header.Get("Cf-Connecting-Ip"); !utils.StringIsEmpty(cfConnectingIp) {
+		chain = []string{normalizeIp(cfConnectingIp)}
+	}
+
+	// Walk back from the closest hop, the first address
+	// we don't trust is the one which talked to our proxies
+	for i := len(chain) - 1; i >= 0; i-- {
+		if utils.StringIsEmpty(chain[i]) {
+			// Obfuscated or garbage entry, nothing before it can be trusted
+			return peer
+		}
+		if !isTrustedProxy(trustedProxies, chain[i]) || i == 0 {
+			return chain[i]
+		}
+	}
+	return peer
+}
+
+// parseForwarded extracts the for= addresses of RFC 7239 Forwarded headers
+func parseForwarded(values []string) []string {
+	var chain []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			ip := ""
+			for _, pair := range strings.Split(element, ";") {
+				pair = strings.TrimSpace(pair)
+				if len(pair) > 4 && strings.EqualFold(pair[:4], "for=") {
+					ip = normalizeIp(strings.Trim(pair[4:], "\""))
+				}
+			}
+			chain = append(chain, ip)
+		}
+	}
+	return chain
+}
+
+// normalizeIp strips ports and brackets, returns an empty string
+// for everything which isn't an ip address
+func normalizeIp(address string) string {
+	address = strings.TrimSpace(address)
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		address = host
+	}
+	address = strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
@@ -0,0 +1,71 @@
+package miniserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResolveClientIp(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8, 192.168.1.1, ::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		ip      string
+	}{
+		{"direct", "1.2.3.4:5000", nil, "1.2.3.4"},
+		{"untrusted peer can't forward", "1.2.3.4:5000",
+			map[string]string{"X-Forwarded-For": "9.9.9.9"}, "1.2.3.4"},
+		{"trusted peer without headers", "10.0.0.1:5000", nil, "10.0.0.1"},
+		{"single hop", "10.0.0.1:5000",
+			map[string]string{"X-Forwarded-For": "9.9.9.9"}, "9.9.9.9"},
+		{"spoofed start of the chain", "10.0.0.1:5000",
+			map[string]string{"X-Forwarded-For": "6.6.6.6, 7.7.7.7"}, "7.7.7.7"},
+		{"trusted hops are skipped", "[::1]:5000",
+			map[string]string{"X-Forwarded-For": "6.6.6.6, 7.7.7.7, 10.0.0.3, 192.168.1.1"}, "7.7.7.7"},
+		{"only trusted hops", "10.0.0.1:5000",
+			map[string]string{"X-Forwarded-For": "10.0.0.2, 10.0.0.3"}, "10.0.0.2"},
+		{"garbage hop", "10.0.0.1:5000",
+			map[string]string{"X-Forwarded-For": "6.6.6.6, unknown, 10.0.0.3"}, "10.0.0.1"},
+		{"forwarded", "10.0.0.1:5000",
+			map[string]string{"Forwarded": `for=192.0.2.60;proto=http, for="[2001:db8:cafe::17]:4711"`},
+			"2001:db8:cafe::17"},
+		{"forwarded wins over x-forwarded-for", "10.0.0.1:5000",
+			map[string]string{"Forwarded": "for=192.0.2.60", "X-Forwarded-For": "9.9.9.9"}, "192.0.2.60"},
+		{"obfuscated forwarded", "10.0.0.1:5000",
+			map[string]string{"Forwarded": "for=_hidden"}, "10.0.0.1"},
+		{"x-real-ip", "10.0.0.1:5000", map[string]string{"X-Real-Ip": "8.8.8.8"}, "8.8.8.8"},
+		{"cf-connecting-ip", "10.0.0.1:5000", map[string]string{"Cf-Connecting-Ip": "8.8.4.4"}, "8.8.4.4"},
+		{"ipv6 peer", "[2001:db8::1]:80", nil, "2001:db8::1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.RemoteAddr = test.remote
+			for key, value := range test.headers {
+				request.Header.Set(key, value)
+			}
+			if ip := resolveClientIp(request, proxies); ip != test.ip {
+				t.Errorf("resolveClientIp = %s, want %s", ip, test.ip)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	for _, text := range []string{"", "10.0.0.0/8", " 10.0.0.1 , ::1", "fd00::/8"} {
+		if _, err := ParseTrustedProxies(text); err != nil {
+			t.Errorf("ParseTrustedProxies(%q) failed %s", text, err)
+		}
+	}
+	for _, text := range []string{"localhost", "10.0.0.0/33", "1.2.3"} {
+		if _, err := ParseTrustedProxies(text); err == nil {
+			t.Errorf("ParseTrustedProxies(%q) didn't fail", text)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package miniserver
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Grarak/GoYTFetcher/utils"
+)
+
+// Bodies smaller than this are not worth compressing on the fly
+const minCompressSize = 256
+
+type encoder struct {
+	name      string
+	newWriter func(writer io.Writer) io.WriteCloser
+}
+
+var encoders = []encoder{
+	{"gzip", func(writer io.Writer) io.WriteCloser {
+		return gzip.NewWriter(writer)
+	}},
+}
+
+var compressibleContentTypes = []string{
+	"text/",
+	ContentJson,
+	ContentSVG,
+	ContentWasm,
+	"application/javascript",
+	"application/xml",
+	"application/manifest+json",
+}
+
+// RegisterEncoder adds a content encoding which is preferred over the
+// existing ones, e.g. brotli when the build ships an implementation
+func RegisterEncoder(name string, newWriter func(writer io.Writer) io.WriteCloser) {
+	encoders = append([]encoder{{name, newWriter}}, encoders...)
+}
+
+func findEncoder(name string) *encoder {
+	for i := range encoders {
+		if encoders[i].name == name {
+			return &encoders[i]
+		}
+	}
+	return nil
+}
+
+func isCompressible(contentType string) bool {
+	for _, compressible := range compressibleContentTypes {
+		if strings.HasPrefix(contentType, compressible) {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateEncoding picks the encoding with the highest quality value
+// from an Accept-Encoding header, ties are broken by the order of available
+func negotiateEncoding(acceptEncoding string, available []string) string {
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		if utils.StringIsEmpty(name) {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		qualities[name] = quality
+	}
+
+	best := ""
+	bestQuality := 0.0
+	for _, name := range available {
+		quality, ok := qualities[name]
+		if !ok {
+			quality, ok = qualities["*"]
+		}
+		if ok && quality > bestQuality {
+			best = name
+			bestQuality = quality
+		}
+	}
+	return best
+}
+
+func (response *SimpleResponse) availableEncodings() []string {
+	var available []string
+	for encoding := range response.precompressed {
+		available = append(available, encoding)
+	}
+	for _, encoder := range encoders {
+		if !utils.StringArrayContains(available, encoder.name) {
+			available = append(available, encoder.name)
+		}
+	}
+	return available
+}
+
+type weakValidator struct {
+	Validator
+}
+
+func (validator weakValidator) ETag() string {
+	etag := validator.Validator.ETag()
+	if utils.StringIsEmpty(etag) || strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return "W/" + etag
+}
+
+func (response *SimpleResponse) writeEncoded(writer http.ResponseWriter, client *Client, encoder *encoder) {
+	statusCode := response.statusCode
+	if validator, ok := response.readHolder.(Validator); ok && statusCode == http.StatusOK {
+		// The encoded body is not byte identical to the original one
+		validator = weakValidator{validator}
+		writeValidators(writer, validator)
+		if isNotModified(client, validator) {
+			writer.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	writer.Header().Set("Content-Encoding", encoder.name)
+	writer.WriteHeader(statusCode)
+
+	encodedWriter := encoder.newWriter(writer)
+	io.Copy(encodedWriter, io.NewSectionReader(response.readHolder, 0, response.readHolder.Size()))
+	encodedWriter.Close()
+}
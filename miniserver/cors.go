@@ -0,0 +1,161 @@
+package miniserver
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Grarak/GoYTFetcher/utils"
+)
+
+// CorsPolicy describes which browser origins may talk to the server.
+// Origins can be "*" or contain a wildcard subdomain like https://*.example.com
+type CorsPolicy struct {
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+func NewCorsPolicy(origins []string) CorsPolicy {
+	for i := range origins {
+		origins[i] = strings.TrimSpace(origins[i])
+	}
+	return CorsPolicy{
+		AllowedOrigins: origins,
+		AllowedMethods: []string{http.MethodGet, http.MethodHead, http.MethodPost,
+			http.MethodPut, http.MethodDelete},
+		AllowedHeaders: []string{"Content-Type", "Authorization", "Range",
+			"If-Range", "If-None-Match", "If-Modified-Since"},
+		ExposedHeaders: []string{"Content-Length", "Content-Range", "Accept-Ranges",
+			"ETag", "Retry-After", "ytfetcher-id"},
+		MaxAge: 10 * time.Minute,
+	}
+}
+
+// Validate rejects credentials for any origin, every web page
+// could then use the cookies of its visitors
+func (policy CorsPolicy) Validate() error {
+	if policy.AllowCredentials && utils.StringArrayContains(policy.AllowedOrigins, "*") {
+		return errors.New("cors credentials can't be allowed for any origin (*)")
+	}
+	return nil
+}
+
+// matchOrigin returns the entry of AllowedOrigins which allows origin
+func (policy CorsPolicy) matchOrigin(origin string) (string, bool) {
+	for _, allowed := range policy.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return allowed, true
+		}
+		if index := strings.Index(allowed, "*."); index >= 0 {
+			prefix := allowed[:index]
+			suffix := allowed[index+1:]
+			if strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) &&
+				len(origin) > len(prefix)+len(suffix) {
+				return allowed, true
+			}
+		}
+	}
+	return "", false
+}
+
+func (policy CorsPolicy) isOriginAllowed(origin string) bool {
+	_, ok := policy.matchOrigin(origin)
+	return ok
+}
+
+// varies tells whether responses differ between origins
+func (policy CorsPolicy) varies() bool {
+	return policy.AllowCredentials || !utils.StringArrayContains(policy.AllowedOrigins, "*")
+}
+
+func (policy CorsPolicy) allowOriginHeaders(origin string) http.Header {
+	headers := make(http.Header)
+	if policy.varies() {
+		// Credentials can't be combined with a wildcard, echo the origin instead
+		headers.Set("Access-Control-Allow-Origin", origin)
+	} else {
+		headers.Set("Access-Control-Allow-Origin", "*")
+	}
+	// Only listed origins get credentials, never the ones matched by *
+	if matched, _ := policy.matchOrigin(origin); policy.AllowCredentials && matched != "*" {
+		headers.Set("Access-Control-Allow-Credentials", "true")
+	}
+	return headers
+}
+
+// Cors answers preflight requests and adds the CORS headers to
+// responses of allowed origins, use it on the router so it runs before routing
+func Cors(policy CorsPolicy) Middleware {
+	return func(next Handler) Handler {
+		return func(client *Client) Response {
+			origin := client.Header.Get("Origin")
+			requestMethod := client.Header.Get("Access-Control-Request-Method")
+			if client.Method == http.MethodOptions && !utils.StringIsEmpty(origin) &&
+				!utils.StringIsEmpty(requestMethod) {
+				return policy.preflight(client, origin)
+			}
+
+			response := next(client)
+			if response == nil {
+				return nil
+			}
+
+			headers := make(http.Header)
+			if !utils.StringIsEmpty(origin) && policy.isOriginAllowed(origin) {
+				headers = policy.allowOriginHeaders(origin)
+				if len(policy.ExposedHeaders) > 0 {
+					headers.Set("Access-Control-Expose-Headers",
+						strings.Join(policy.ExposedHeaders, ", "))
+				}
+			}
+			if policy.varies() {
+				headers.Set("Vary", "Origin")
+			}
+			if len(headers) == 0 {
+				return response
+			}
+			return &headerResponse{response, headers}
+		}
+	}
+}
+
+func (policy CorsPolicy) preflight(client *Client, origin string) Response {
+	response := client.ResponseBodyBytes(nil)
+	response.SetContentType("")
+	response.SetStatusCode(http.StatusNoContent)
+	response.SetHeader("Vary", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers")
+	if !policy.isOriginAllowed(origin) {
+		return response
+	}
+
+	for key, values := range policy.allowOriginHeaders(origin) {
+		response.SetHeader(key, values[0])
+	}
+	response.SetHeader("Access-Control-Allow-Methods", strings.Join(policy.AllowedMethods, ", "))
+	response.SetHeader("Access-Control-Allow-Headers", strings.Join(policy.AllowedHeaders, ", "))
+	if policy.MaxAge > 0 {
+		response.SetHeader("Access-Control-Max-Age", strconv.Itoa(int(policy.MaxAge.Seconds())))
+	}
+	return response
+}
+
+// headerResponse adds headers to whatever the wrapped response writes
+type headerResponse struct {
+	Response
+	headers http.Header
+}
+
+func (response *headerResponse) write(writer http.ResponseWriter, client *Client) {
+	for key, values := range response.headers {
+		for _, value := range values {
+			writer.Header().Add(key, value)
+		}
+	}
+	response.Response.write(writer, client)
+}
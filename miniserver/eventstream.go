@@ -0,0 +1,94 @@
+package miniserver
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const ContentEventStream = "text/event-stream"
+
+// Comments sent while nothing happens, so proxies keep the connection
+// open and disconnected clients are noticed
+const eventStreamKeepAlive = 15 * time.Second
+
+type ServerSentEvent struct {
+	Id    string
+	Event string
+	Data  []byte
+}
+
+// EventStreamResponse keeps the connection open and writes every event
+// from the channel as server-sent event until the client goes away,
+// the channel is closed or the server shuts down
+type EventStreamResponse struct {
+	events <-chan ServerSentEvent
+	done   func()
+}
+
+// NewEventStreamResponse streams events, done is called once the stream ended
+func NewEventStreamResponse(events <-chan ServerSentEvent, done func()) *EventStreamResponse {
+	return &EventStreamResponse{events, done}
+}
+
+func (response *EventStreamResponse) write(writer http.ResponseWriter, client *Client) {
+	if response.done != nil {
+		defer response.done()
+	}
+
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", ContentEventStream)
+	writer.Header().Set("Cache-Control", "no-cache")
+	// Stops nginx from buffering the stream
+	writer.Header().Set("X-Accel-Buffering", "no")
+	writer.WriteHeader(http.StatusOK)
+	if _, err := writer.Write([]byte(fmt.Sprintf("retry: %d\n\n",
+		eventStreamKeepAlive/time.Millisecond))); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventStreamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		var payload []byte
+		select {
+		case event, ok := <-response.events:
+			if !ok {
+				return
+			}
+			payload = event.encode()
+		case <-keepAlive.C:
+			payload = []byte(": keep-alive\n\n")
+		case <-client.closing:
+			return
+		}
+
+		if _, err := writer.Write(payload); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func (event ServerSentEvent) encode() []byte {
+	buf := new(bytes.Buffer)
+	if len(event.Id) > 0 {
+		fmt.Fprintf(buf, "id: %s\n", event.Id)
+	}
+	if len(event.Event) > 0 {
+		fmt.Fprintf(buf, "event: %s\n", event.Event)
+	}
+	for _, line := range bytes.Split(event.Data, []byte("\n")) {
+		fmt.Fprintf(buf, "data: %s\n", line)
+	}
+	buf.WriteString("\n")
+	return buf.Bytes()
+}
@@ -3,46 +3,158 @@ package miniserver
 import (
 	"bytes"
 	"io"
+	"net"
 	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Grarak/GoYTFetcher/logger"
 )
 
+// Headers which only apply to a single connection and must not be forwarded
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Headers of our clients which are none of the upstream's business
+var privateHeaders = []string{
+	"Authorization",
+	"Cookie",
+	"Cf-Connecting-Ip",
+	"Forwarded",
+	"X-Forwarded-For",
+	"X-Real-Ip",
+}
+
+var forwardClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 15 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConnsPerHost:   16,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
 type ForwardResponse struct {
-	u string
+	u       string
+	refresh func() (string, error)
 }
 
 func NewForwardResponse(u string) *ForwardResponse {
-	return &ForwardResponse{u}
+	return &ForwardResponse{u: u}
+}
+
+// SetRefresh sets a function which resolves a new upstream url,
+// it's used once when the upstream rejects the current one as expired
+func (forwardResponse *ForwardResponse) SetRefresh(refresh func() (string, error)) {
+	forwardResponse.refresh = refresh
 }
 
 func (forwardResponse *ForwardResponse) write(writer http.ResponseWriter, client *Client) {
-	errWriter := func() {
-		writer.WriteHeader(http.StatusNotFound)
-	}
+	uResponse, err := forwardResponse.request(forwardResponse.u, client)
+	if err == nil && isExpiredStatus(uResponse.StatusCode) && forwardResponse.refresh != nil {
+		uResponse.Body.Close()
 
-	uClient := &http.Client{}
-	uRequest, err := http.NewRequest(client.Method, forwardResponse.u,
-		bytes.NewReader(client.Request))
+		var u string
+		u, err = forwardResponse.refresh()
+		if err == nil {
+			uResponse, err = forwardResponse.request(u, client)
+		}
+	}
 
 	if err != nil {
-		errWriter()
+		logger.E(client.IPAddr + ": failed to forward " + client.Url + " " + err.Error())
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			writer.WriteHeader(http.StatusGatewayTimeout)
+		} else {
+			writer.WriteHeader(http.StatusBadGateway)
+		}
 		return
 	}
+	defer uResponse.Body.Close()
 
-	for key := range client.Header {
-		uRequest.Header.Set(key, client.Header.Get(key))
-	}
-
-	uResponse, err := uClient.Do(uRequest)
-	if err != nil {
-		errWriter()
+	if isExpiredStatus(uResponse.StatusCode) {
+		writer.WriteHeader(http.StatusBadGateway)
 		return
 	}
-	defer uResponse.Body.Close()
 
 	for key := range uResponse.Header {
-		writer.Header().Set(key, uResponse.Header.Get(key))
+		// Our own CORS policy decides what browsers may read
+		if strings.HasPrefix(key, "Access-Control-") {
+			uResponse.Header.Del(key)
+		}
 	}
+	copyHeaders(writer.Header(), uResponse.Header)
 	writer.WriteHeader(uResponse.StatusCode)
 
 	io.Copy(writer, uResponse.Body)
 }
+
+func (forwardResponse *ForwardResponse) request(u string, client *Client) (*http.Response, error) {
+	// Requests of clients which disconnected are pointless upstream as well
+	uRequest, err := http.NewRequestWithContext(client.Context(), client.Method, u,
+		bytes.NewReader(client.Request))
+	if err != nil {
+		return nil, err
+	}
+
+	copyHeaders(uRequest.Header, client.Header)
+	for _, header := range privateHeaders {
+		uRequest.Header.Del(header)
+	}
+	return forwardClient.Do(uRequest)
+}
+
+func isExpiredStatus(statusCode int) bool {
+	return statusCode == http.StatusForbidden || statusCode == http.StatusGone
+}
+
+// copyHeaders copies all end-to-end headers from src to dst
+func copyHeaders(dst, src http.Header) {
+	connectionHeaders := make([]string, 0)
+	for _, value := range src["Connection"] {
+		for _, header := range strings.Split(value, ",") {
+			connectionHeaders = append(connectionHeaders,
+				http.CanonicalHeaderKey(strings.TrimSpace(header)))
+		}
+	}
+
+	for key, values := range src {
+		if isHopByHopHeader(key) || containsHeader(connectionHeaders, key) {
+			continue
+		}
+		for _, value := range values {
+			dst.Add(key, value)
+		}
+	}
+}
+
+func isHopByHopHeader(key string) bool {
+	return containsHeader(hopByHopHeaders, key)
+}
+
+func containsHeader(headers []string, key string) bool {
+	key = http.CanonicalHeaderKey(key)
+	for _, header := range headers {
+		if header == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package miniserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestForwardResponseClientDisconnect(t *testing.T) {
+	received := make(chan struct{})
+	canceled := make(chan struct{})
+	finished := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusOK)
+		writer.(http.Flusher).Flush()
+		close(received)
+		select {
+		case <-request.Context().Done():
+			close(canceled)
+		case <-finished:
+		}
+	}))
+	defer upstream.Close()
+	defer close(finished)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	request := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	client := newClient(request, nil)
+
+	done := make(chan struct{})
+	go func() {
+		NewForwardResponse(upstream.URL).write(httptest.NewRecorder(), client)
+		close(done)
+	}()
+	<-received
+	cancel()
+
+	for _, wait := range []chan struct{}{canceled, done} {
+		select {
+		case <-wait:
+		case <-time.After(5 * time.Second):
+			t.Fatal("upstream request outlived the client")
+		}
+	}
+}
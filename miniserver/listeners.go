@@ -0,0 +1,163 @@
+package miniserver
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"github.com/Grarak/GoYTFetcher/utils"
+)
+
+const (
+	unixPrefix    = "unix:"
+	systemdPrefix = "systemd"
+	// First file descriptor passed by systemd socket activation
+	systemdListenFdsStart = 3
+)
+
+// AddListenAddress adds an address to listen on, without any the server
+// listens on all interfaces on its port. Supported are tcp addresses like
+// :6713 or 127.0.0.1:6714, unix:/path/to/socket, systemd for all sockets
+// passed by socket activation or systemd:name for the ones with that FileDescriptorName
+func (miniserver *MiniServer) AddListenAddress(address string) {
+	miniserver.listenAddresses = append(miniserver.listenAddresses, address)
+}
+
+// SetUnixSocketPermissions applies mode and, if not empty,
+// the owning group to the created unix sockets
+func (miniserver *MiniServer) SetUnixSocketPermissions(mode os.FileMode, group string) {
+	miniserver.unixSocketMode = mode
+	miniserver.unixSocketGroup = group
+}
+
+func (miniserver *MiniServer) listen() ([]net.Listener, error) {
+	addresses := miniserver.listenAddresses
+	if len(addresses) == 0 {
+		addresses = []string{":" + strconv.Itoa(miniserver.port)}
+	}
+
+	var activated map[string][]net.Listener
+	var listeners []net.Listener
+	closeAll := func() {
+		for _, listener := range listeners {
+			listener.Close()
+		}
+	}
+
+	for _, address := range addresses {
+		switch {
+		case strings.HasPrefix(address, unixPrefix):
+			listener, err := miniserver.listenUnix(strings.TrimPrefix(address, unixPrefix))
+			if err != nil {
+				closeAll()
+				return nil, err
+			}
+			listeners = append(listeners, listener)
+		case address == systemdPrefix || strings.HasPrefix(address, systemdPrefix+":"):
+			if activated == nil {
+				var err error
+				if activated, err = systemdListeners(); err != nil {
+					closeAll()
+					return nil, err
+				}
+			}
+
+			name := strings.TrimPrefix(strings.TrimPrefix(address, systemdPrefix), ":")
+			var matched []net.Listener
+			for fdName, fdListeners := range activated {
+				if utils.StringIsEmpty(name) || name == fdName {
+					matched = append(matched, fdListeners...)
+				}
+			}
+			if len(matched) == 0 {
+				closeAll()
+				return nil, fmt.Errorf("no sockets passed by systemd for %s", address)
+			}
+			listeners = append(listeners, matched...)
+		default:
+			listener, err := net.Listen("tcp", address)
+			if err != nil {
+				closeAll()
+				return nil, err
+			}
+			listeners = append(listeners, listener)
+		}
+	}
+	return listeners, nil
+}
+
+func (miniserver *MiniServer) listenUnix(path string) (net.Listener, error) {
+	// A socket left behind by a previous run would make listening fail
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := miniserver.unixSocketMode
+	if mode == 0 {
+		mode = 0660
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	if !utils.StringIsEmpty(miniserver.unixSocketGroup) {
+		group, err := user.LookupGroup(miniserver.unixSocketGroup)
+		if err != nil {
+			listener.Close()
+			return nil, err
+		}
+		gid, err := strconv.Atoi(group.Gid)
+		if err == nil {
+			err = os.Chown(path, -1, gid)
+		}
+		if err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+	return listener, nil
+}
+
+// systemdListeners takes over the sockets passed with LISTEN_FDS,
+// grouped by their name from LISTEN_FDNAMES
+func systemdListeners() (map[string][]net.Listener, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, fmt.Errorf("no sockets passed by systemd")
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, fmt.Errorf("no sockets passed by systemd")
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	// Child processes like youtube-dl must not think they got the sockets
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make(map[string][]net.Listener)
+	for i := 0; i < count; i++ {
+		name := "LISTEN_FD_" + strconv.Itoa(systemdListenFdsStart+i)
+		if i < len(names) && !utils.StringIsEmpty(names[i]) {
+			name = names[i]
+		}
+
+		file := os.NewFile(uintptr(systemdListenFdsStart+i), name)
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("socket %s passed by systemd %s", name, err)
+		}
+		listeners[name] = append(listeners[name], listener)
+	}
+	return listeners, nil
+}
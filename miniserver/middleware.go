@@ -0,0 +1,39 @@
+package miniserver
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/Grarak/GoYTFetcher/logger"
+)
+
+// Recovery answers with 500 instead of taking down the connection
+// when a handler panics
+func Recovery(next Handler) Handler {
+	return func(client *Client) (response Response) {
+		defer func() {
+			if err := recover(); err != nil {
+				logger.E(fmt.Sprintf("%s: panic while serving %s %s: %v\n%s",
+					client.IPAddr, client.Method, client.Url, err, debug.Stack()))
+
+				simpleResponse := client.ResponseBody("Internal server error")
+				simpleResponse.SetStatusCode(http.StatusInternalServerError)
+				response = simpleResponse
+			}
+		}()
+		return next(client)
+	}
+}
+
+// RequireJson rejects requests whose body is not declared as json
+func RequireJson(next Handler) Handler {
+	return func(client *Client) Response {
+		if !client.IsContentJson() {
+			response := client.ResponseBody("Unsupported media type")
+			response.SetStatusCode(http.StatusUnsupportedMediaType)
+			return response
+		}
+		return next(client)
+	}
+}
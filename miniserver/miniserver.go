@@ -1,12 +1,18 @@
 package miniserver
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
 	"net"
 	"net/http"
+	"os"
 	"strconv"
-
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/Grarak/GoYTFetcher/logger"
 	"github.com/Grarak/GoYTFetcher/utils"
 )
 
@@ -16,27 +22,65 @@ const (
 	ContentJson        = "application/json"
 	ContentJavascript  = "text/javascript"
 	ContentCss         = "text/css"
+	ContentXml         = "application/xml"
 	ContentXIcon       = "image/x-icon"
 	ContentSVG         = "image/svg+xml"
+	ContentPng         = "image/png"
+	ContentJpeg        = "image/jpeg"
+	ContentGif         = "image/gif"
+	ContentWebp        = "image/webp"
+	ContentAvif        = "image/avif"
 	ContentOgg         = "audio/ogg"
+	ContentOpus        = "audio/opus"
+	ContentMpeg        = "audio/mpeg"
+	ContentMp4         = "video/mp4"
+	ContentWebm        = "video/webm"
+	ContentWoff        = "font/woff"
+	ContentWoff2       = "font/woff2"
+	ContentTtf         = "font/ttf"
+	ContentOtf         = "font/otf"
+	ContentWebManifest = "application/manifest+json"
+	ContentPdf         = "application/pdf"
 	ContentOctetStream = "application/octet-stream"
 	ContentWasm        = "application/wasm"
 )
 
 var FileExtensions = [][]string{
 	{"html", ContentHtml},
+	{"htm", ContentHtml},
+	{"txt", ContentText},
 	{"js", ContentJavascript},
+	{"mjs", ContentJavascript},
 	{"css", ContentCss},
+	{"json", ContentJson},
+	{"map", ContentJson},
+	{"xml", ContentXml},
 	{"ico", ContentXIcon},
 	{"svg", ContentSVG},
+	{"png", ContentPng},
+	{"jpg", ContentJpeg},
+	{"jpeg", ContentJpeg},
+	{"gif", ContentGif},
+	{"webp", ContentWebp},
+	{"avif", ContentAvif},
 	{"ogg", ContentOgg},
+	{"opus", ContentOpus},
+	{"mp3", ContentMpeg},
+	{"mp4", ContentMp4},
+	{"webm", ContentWebm},
+	{"woff", ContentWoff},
+	{"woff2", ContentWoff2},
+	{"ttf", ContentTtf},
+	{"otf", ContentOtf},
+	{"webmanifest", ContentWebManifest},
+	{"pdf", ContentPdf},
 	{"wasm", ContentWasm},
 }
 
 func getContentTypeForFile(file string) string {
 	index := strings.LastIndex(file, ".")
 	if index >= 0 {
-		extension := file[index+1:]
+		extension := strings.ToLower(file[index+1:])
 		for _, contentType := range FileExtensions {
 			if contentType[0] == extension {
 				return contentType[1]
@@ -46,41 +90,190 @@ func getContentTypeForFile(file string) string {
 	return ContentOctetStream
 }
 
+// Timeouts for incoming connections, there is deliberately no write
+// timeout as audio streams can take as long as the song plays
+type Timeouts struct {
+	ReadHeader, Read, Idle time.Duration
+}
+
 type MiniServer struct {
-	port     int
-	listener net.Listener
+	port      int
+	listeners []net.Listener
+	server    *http.Server
+
+	listenAddresses []string
+	unixSocketMode  os.FileMode
+	unixSocketGroup string
+
+	trustedProxies []*net.IPNet
+	timeouts       Timeouts
+	accessLog      *AccessLog
+	observer       RequestObserver
+
+	tlsCertificate *certificateReloader
+	redirectPort   int
+	redirectServer *http.Server
+
+	closing   chan struct{}
+	closeOnce sync.Once
 }
 
 func NewServer(port int) *MiniServer {
 	return &MiniServer{
-		port: port,
+		port:    port,
+		closing: make(chan struct{}),
 	}
 }
 
+// SetTrustedProxies sets the peers whose forwarding headers
+// are used to determine the address of the client
+func (miniserver *MiniServer) SetTrustedProxies(trustedProxies []*net.IPNet) {
+	miniserver.trustedProxies = trustedProxies
+}
+
+func (miniserver *MiniServer) SetTimeouts(timeouts Timeouts) {
+	miniserver.timeouts = timeouts
+}
+
+// SetAccessLog records every request once its response got written
+func (miniserver *MiniServer) SetAccessLog(accessLog *AccessLog) {
+	miniserver.accessLog = accessLog
+}
+
+// RequestObserver is told about every request once its response got written
+type RequestObserver func(client *Client, status int, size int64, duration time.Duration)
+
+func (miniserver *MiniServer) SetRequestObserver(observer RequestObserver) {
+	miniserver.observer = observer
+}
+
+// EnableTLS serves HTTPS and HTTP/2 with the given certificate,
+// changes to the files on disk are picked up without a restart
+func (miniserver *MiniServer) EnableTLS(certFile, keyFile string) error {
+	certificate, err := newCertificateReloader(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	miniserver.tlsCertificate = certificate
+	return nil
+}
+
+// EnableRedirect starts a plain HTTP listener on port which
+// redirects every request to the HTTPS port
+func (miniserver *MiniServer) EnableRedirect(port int) {
+	miniserver.redirectPort = port
+}
+
 func (miniserver *MiniServer) StartListening(callback func(client *Client) Response) {
-	http.HandleFunc("/", func(writer http.ResponseWriter, request *http.Request) {
+	handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
 		defer request.Body.Close()
 
-		request.ParseForm()
-		client := newClient(request)
+		start := time.Now()
+		recorder := &responseRecorder{ResponseWriter: writer, status: http.StatusOK}
+		client := newClient(request, miniserver.trustedProxies)
+		client.closing = miniserver.closing
 
 		res := callback(client)
 		if res == nil {
-			writer.WriteHeader(http.StatusNotFound)
-			writer.Write([]byte("Not found"))
+			recorder.WriteHeader(http.StatusNotFound)
+			recorder.Write([]byte("Not found"))
 		} else {
-			res.write(writer, client)
+			res.write(recorder, client)
+		}
+
+		duration := time.Since(start)
+		if miniserver.accessLog != nil {
+			miniserver.accessLog.log(client, request, recorder, duration)
+		}
+		if miniserver.observer != nil {
+			miniserver.observer(client, recorder.status, recorder.size, duration)
 		}
 	})
 
-	listener, err := net.Listen("tcp", ":"+strconv.Itoa(miniserver.port))
+	listeners, err := miniserver.listen()
 	utils.Panic(err)
-	miniserver.listener = listener
-	http.Serve(listener, nil)
+	miniserver.listeners = listeners
+	miniserver.server = &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: miniserver.timeouts.ReadHeader,
+		ReadTimeout:       miniserver.timeouts.Read,
+		IdleTimeout:       miniserver.timeouts.Idle,
+	}
+
+	if miniserver.tlsCertificate != nil {
+		if miniserver.redirectPort > 0 {
+			miniserver.redirectServer = &http.Server{
+				Addr:    ":" + strconv.Itoa(miniserver.redirectPort),
+				Handler: newRedirectHandler(miniserver.port),
+			}
+			go func() {
+				err := miniserver.redirectServer.ListenAndServe()
+				if err != nil && err != http.ErrServerClosed {
+					logger.E(fmt.Sprintf("Redirect listener failed %s", err))
+				}
+			}()
+		}
+
+		miniserver.server.TLSConfig = &tls.Config{
+			GetCertificate: miniserver.tlsCertificate.getCertificate,
+			NextProtos:     []string{"h2", "http/1.1"},
+			MinVersion:     tls.VersionTLS12,
+		}
+	}
+
+	var serving sync.WaitGroup
+	for _, listener := range listeners {
+		logger.I("Listening on " + listener.Addr().Network() + " " + listener.Addr().String())
+
+		serving.Add(1)
+		go func(listener net.Listener) {
+			defer serving.Done()
+			var err error
+			if miniserver.tlsCertificate == nil {
+				err = miniserver.server.Serve(listener)
+			} else {
+				err = miniserver.server.ServeTLS(listener, "", "")
+			}
+			if err != nil && err != http.ErrServerClosed {
+				logger.E(fmt.Sprintf("Listener %s failed %s", listener.Addr(), err))
+			}
+		}(listener)
+	}
+	serving.Wait()
 }
 
 func (miniserver *MiniServer) StopListening() {
-	if miniserver.listener != nil {
-		miniserver.listener.Close()
+	miniserver.closeStreams()
+	for _, listener := range miniserver.listeners {
+		listener.Close()
+	}
+	if miniserver.redirectServer != nil {
+		miniserver.redirectServer.Close()
+	}
+}
+
+// Shutdown stops accepting connections and waits for in-flight
+// requests until ctx is done, whatever is left then gets closed
+func (miniserver *MiniServer) Shutdown(ctx context.Context) error {
+	miniserver.closeStreams()
+	if miniserver.redirectServer != nil {
+		miniserver.redirectServer.Shutdown(ctx)
+	}
+	if miniserver.server == nil {
+		return nil
 	}
+
+	err := miniserver.server.Shutdown(ctx)
+	if err != nil {
+		miniserver.server.Close()
+	}
+	return err
+}
+
+// closeStreams ends long lived responses like event streams,
+// otherwise they would hold up the shutdown
+func (miniserver *MiniServer) closeStreams() {
+	miniserver.closeOnce.Do(func() {
+		close(miniserver.closing)
+	})
 }
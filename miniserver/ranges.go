@@ -0,0 +1,216 @@
+package miniserver
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Grarak/GoYTFetcher/utils"
+)
+
+// Validator is implemented by read holders which can identify
+// their content, so clients can revalidate and resume it
+type Validator interface {
+	ETag() string
+	ModTime() time.Time
+}
+
+var errNoOverlap = errors.New("invalid range: failed to overlap")
+
+type httpRange struct {
+	start, length int64
+}
+
+func (r httpRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+func (r httpRange) mimeHeader(contentType string, size int64) textproto.MIMEHeader {
+	return textproto.MIMEHeader{
+		"Content-Range": {r.contentRange(size)},
+		"Content-Type":  {contentType},
+	}
+}
+
+func writeValidators(writer http.ResponseWriter, validator Validator) {
+	if etag := validator.ETag(); !utils.StringIsEmpty(etag) {
+		writer.Header().Set("ETag", etag)
+	}
+	if modTime := validator.ModTime(); !modTime.IsZero() {
+		writer.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+}
+
+func isNotModified(client *Client, validator Validator) bool {
+	if client.Method != http.MethodGet && client.Method != http.MethodHead {
+		return false
+	}
+
+	if ifNoneMatch := client.Header.Get("If-None-Match"); !utils.StringIsEmpty(ifNoneMatch) {
+		etag := validator.ETag()
+		if utils.StringIsEmpty(etag) {
+			return false
+		}
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || weakETagMatch(candidate, etag) {
+				return true
+			}
+		}
+		return false
+	}
+
+	ifModifiedSince, err := http.ParseTime(client.Header.Get("If-Modified-Since"))
+	modTime := validator.ModTime()
+	if err != nil || modTime.IsZero() {
+		return false
+	}
+	return !modTime.Truncate(time.Second).After(ifModifiedSince)
+}
+
+// ifRangeMatches reports whether the Range header should be honoured
+func ifRangeMatches(client *Client, validator Validator) bool {
+	ifRange := strings.TrimSpace(client.Header.Get("If-Range"))
+	if utils.StringIsEmpty(ifRange) {
+		return true
+	}
+
+	if strings.HasPrefix(ifRange, "\"") {
+		etag := validator.ETag()
+		return !utils.StringIsEmpty(etag) && ifRange == etag
+	}
+
+	date, err := http.ParseTime(ifRange)
+	modTime := validator.ModTime()
+	return err == nil && !modTime.IsZero() && modTime.Truncate(time.Second).Equal(date)
+}
+
+func weakETagMatch(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+// parseRanges parses a Range header such as "bytes=0-499,-500"
+// and drops every range which does not overlap the content
+func parseRanges(header string, size int64) ([]httpRange, error) {
+	if !strings.HasPrefix(header, "bytes=") {
+		return nil, errors.New("invalid range unit")
+	}
+
+	var ranges []httpRange
+	noOverlap := false
+	for _, spec := range strings.Split(header[len("bytes="):], ",") {
+		spec = strings.TrimSpace(spec)
+		if utils.StringIsEmpty(spec) {
+			continue
+		}
+		middleIndex := strings.Index(spec, "-")
+		if middleIndex < 0 {
+			return nil, errors.New("invalid range")
+		}
+		startText := strings.TrimSpace(spec[:middleIndex])
+		endText := strings.TrimSpace(spec[middleIndex+1:])
+
+		var r httpRange
+		if utils.StringIsEmpty(startText) {
+			// Suffix range, the last n bytes
+			suffix, err := strconv.ParseInt(endText, 10, 64)
+			if err != nil || suffix < 0 {
+				return nil, errors.New("invalid range")
+			}
+			if suffix == 0 || size == 0 {
+				noOverlap = true
+				continue
+			}
+			if suffix > size {
+				suffix = size
+			}
+			r.start = size - suffix
+			r.length = suffix
+		} else {
+			start, err := strconv.ParseInt(startText, 10, 64)
+			if err != nil || start < 0 {
+				return nil, errors.New("invalid range")
+			}
+			if start >= size {
+				noOverlap = true
+				continue
+			}
+			r.start = start
+			if utils.StringIsEmpty(endText) {
+				r.length = size - start
+			} else {
+				end, err := strconv.ParseInt(endText, 10, 64)
+				if err != nil || start > end {
+					return nil, errors.New("invalid range")
+				}
+				if end >= size {
+					end = size - 1
+				}
+				r.length = end - start + 1
+			}
+		}
+		ranges = append(ranges, r)
+	}
+
+	if len(ranges) == 0 && noOverlap {
+		return nil, errNoOverlap
+	}
+	if len(ranges) == 0 {
+		return nil, errors.New("invalid range")
+	}
+	return ranges, nil
+}
+
+func sumRangesSize(ranges []httpRange) int64 {
+	var size int64
+	for _, r := range ranges {
+		size += r.length
+	}
+	return size
+}
+
+type countingWriter int64
+
+func (writer *countingWriter) Write(p []byte) (int, error) {
+	*writer += countingWriter(len(p))
+	return len(p), nil
+}
+
+func multipartRangesSize(ranges []httpRange, contentType string, size int64) int64 {
+	var written countingWriter
+	partWriter := multipart.NewWriter(&written)
+	for _, r := range ranges {
+		partWriter.CreatePart(r.mimeHeader(contentType, size))
+		written += countingWriter(r.length)
+	}
+	partWriter.Close()
+	return int64(written)
+}
+
+func writeMultipartRanges(writer http.ResponseWriter, reader io.ReaderAt,
+	contentType string, ranges []httpRange, size int64) {
+	partWriter := multipart.NewWriter(writer)
+
+	writer.Header().Set("Content-Type",
+		"multipart/byteranges; boundary="+partWriter.Boundary())
+	writer.Header().Set("Content-Length",
+		fmt.Sprint(multipartRangesSize(ranges, contentType, size)))
+	writer.WriteHeader(http.StatusPartialContent)
+
+	for _, r := range ranges {
+		part, err := partWriter.CreatePart(r.mimeHeader(contentType, size))
+		if err != nil {
+			return
+		}
+		if _, err := io.Copy(part, io.NewSectionReader(reader, r.start, r.length)); err != nil {
+			return
+		}
+	}
+	partWriter.Close()
+}
@@ -0,0 +1,96 @@
+package miniserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseRanges(t *testing.T) {
+	tests := []struct {
+		header string
+		size   int64
+		ranges []httpRange
+		err    error
+	}{
+		{"bytes=0-4", 10, []httpRange{{0, 5}}, nil},
+		{"bytes=2-", 10, []httpRange{{2, 8}}, nil},
+		{"bytes=-3", 10, []httpRange{{7, 3}}, nil},
+		{"bytes=-30", 10, []httpRange{{0, 10}}, nil},
+		{"bytes=5-100", 10, []httpRange{{5, 5}}, nil},
+		{"bytes=0-0, 9-9", 10, []httpRange{{0, 1}, {9, 1}}, nil},
+		{"bytes=0-1,,4-5", 10, []httpRange{{0, 2}, {4, 2}}, nil},
+		{"bytes=20-30, 2-3", 10, []httpRange{{2, 2}}, nil},
+		{"bytes=10-", 10, nil, errNoOverlap},
+		{"bytes=10-20, 30-", 10, nil, errNoOverlap},
+		{"bytes=-0", 10, nil, errNoOverlap},
+		{"bytes=0-", 0, nil, errNoOverlap},
+		{"bytes=-5", 0, nil, errNoOverlap},
+	}
+	for _, test := range tests {
+		ranges, err := parseRanges(test.header, test.size)
+		if err != test.err || !reflect.DeepEqual(ranges, test.ranges) {
+			t.Errorf("parseRanges(%q, %d) = %v, %v, want %v, %v",
+				test.header, test.size, ranges, err, test.ranges, test.err)
+		}
+	}
+
+	for _, header := range []string{"", "bytes", "items=0-1", "bytes=", "bytes=5",
+		"bytes=5-2", "bytes=a-b", "bytes=-1-2", "bytes=--1", "bytes=1-x"} {
+		if ranges, err := parseRanges(header, 10); err == nil || err == errNoOverlap {
+			t.Errorf("parseRanges(%q) = %v, %v, want invalid", header, ranges, err)
+		}
+	}
+}
+
+func TestRangeResponse(t *testing.T) {
+	body := "0123456789"
+	tests := []struct {
+		name         string
+		etag         bool
+		headers      map[string]string
+		status       int
+		body         string
+		contentRange string
+	}{
+		{"no range", false, nil, http.StatusOK, body, ""},
+		{"single", false, map[string]string{"Range": "bytes=2-4"}, http.StatusPartialContent, "234", "bytes 2-4/10"},
+		{"suffix", false, map[string]string{"Range": "bytes=-2"}, http.StatusPartialContent, "89", "bytes 8-9/10"},
+		{"end clamped", false, map[string]string{"Range": "bytes=8-20"}, http.StatusPartialContent, "89", "bytes 8-9/10"},
+		{"unsatisfiable", false, map[string]string{"Range": "bytes=10-"},
+			http.StatusRequestedRangeNotSatisfiable, "", "bytes */10"},
+		{"zero suffix", false, map[string]string{"Range": "bytes=-0"},
+			http.StatusRequestedRangeNotSatisfiable, "", "bytes */10"},
+		{"malformed ignored", false, map[string]string{"Range": "bytes=4-2"}, http.StatusOK, body, ""},
+		{"other unit ignored", false, map[string]string{"Range": "lines=1-2"}, http.StatusOK, body, ""},
+		{"excessive ignored", false, map[string]string{"Range": "bytes=0-9,0-9"}, http.StatusOK, body, ""},
+		{"stale if-range", true, map[string]string{"Range": "bytes=2-4", "If-Range": "\"other\""},
+			http.StatusOK, body, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			for key, value := range test.headers {
+				request.Header.Set(key, value)
+			}
+			client := newClient(request, nil)
+			recorder := httptest.NewRecorder()
+			response := client.ResponseBody(body)
+			if test.etag {
+				response.EnableETag()
+			}
+			response.write(recorder, client)
+
+			if recorder.Code != test.status {
+				t.Errorf("status %d, want %d", recorder.Code, test.status)
+			}
+			if recorder.Body.String() != test.body {
+				t.Errorf("body %q, want %q", recorder.Body.String(), test.body)
+			}
+			if contentRange := recorder.Header().Get("Content-Range"); contentRange != test.contentRange {
+				t.Errorf("Content-Range %q, want %q", contentRange, test.contentRange)
+			}
+		})
+	}
+}
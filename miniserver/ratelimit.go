@@ -0,0 +1,136 @@
+package miniserver
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Grarak/GoYTFetcher/utils"
+)
+
+// RateLimit allows Requests per duration Per, bursts up to Requests are fine
+type RateLimit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// ParseRateLimit parses limits like "30/1m", "0" disables the limit
+func ParseRateLimit(text string) (RateLimit, error) {
+	text = strings.TrimSpace(text)
+	if utils.StringIsEmpty(text) || text == "0" {
+		return RateLimit{}, nil
+	}
+
+	slashIndex := strings.Index(text, "/")
+	if slashIndex < 0 {
+		return RateLimit{}, fmt.Errorf("rate limit %s is missing a duration", text)
+	}
+	requests, err := strconv.Atoi(text[:slashIndex])
+	if err != nil || requests < 0 {
+		return RateLimit{}, fmt.Errorf("invalid request count in rate limit %s", text)
+	}
+	per, err := time.ParseDuration(text[slashIndex+1:])
+	if err != nil || per <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid duration in rate limit %s", text)
+	}
+	return RateLimit{requests, per}, nil
+}
+
+func (rateLimit RateLimit) Enabled() bool {
+	return rateLimit.Requests > 0 && rateLimit.Per > 0
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter keeps a token bucket per key
+type RateLimiter struct {
+	limit       RateLimit
+	buckets     map[string]*tokenBucket
+	lastCleanup time.Time
+	lock        sync.Mutex
+}
+
+func NewRateLimiter(limit RateLimit) *RateLimiter {
+	return &RateLimiter{
+		limit:       limit,
+		buckets:     make(map[string]*tokenBucket),
+		lastCleanup: time.Now(),
+	}
+}
+
+func (limiter *RateLimiter) Limit() RateLimit {
+	return limiter.limit
+}
+
+// Allow takes a token from the bucket of every key, tokens are only
+// taken if all of them have one left. Otherwise it reports how long
+// the caller has to wait until they have.
+func (limiter *RateLimiter) Allow(keys ...string) (bool, time.Duration) {
+	if !limiter.limit.Enabled() {
+		return true, 0
+	}
+
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+
+	now := time.Now()
+	limiter.cleanup(now)
+
+	capacity := float64(limiter.limit.Requests)
+	rate := capacity / limiter.limit.Per.Seconds()
+
+	buckets := make([]*tokenBucket, len(keys))
+	var retryAfter time.Duration
+	for i, key := range keys {
+		bucket, ok := limiter.buckets[key]
+		if !ok {
+			bucket = &tokenBucket{capacity, now}
+			limiter.buckets[key] = bucket
+		}
+		bucket.tokens = math.Min(capacity, bucket.tokens+now.Sub(bucket.last).Seconds()*rate)
+		bucket.last = now
+		buckets[i] = bucket
+
+		if bucket.tokens < 1 {
+			wait := time.Duration((1 - bucket.tokens) / rate * float64(time.Second))
+			if wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+	}
+	if retryAfter > 0 {
+		return false, retryAfter
+	}
+
+	for _, bucket := range buckets {
+		bucket.tokens--
+	}
+	return true, 0
+}
+
+// cleanup forgets buckets which have been refilled completely anyway
+func (limiter *RateLimiter) cleanup(now time.Time) {
+	if now.Sub(limiter.lastCleanup) < limiter.limit.Per {
+		return
+	}
+	limiter.lastCleanup = now
+	for key, bucket := range limiter.buckets {
+		if now.Sub(bucket.last) >= limiter.limit.Per {
+			delete(limiter.buckets, key)
+		}
+	}
+}
+
+func (client *Client) ResponseTooManyRequests(retryAfter time.Duration) *SimpleResponse {
+	response := client.ResponseBody("Too many requests")
+	response.SetStatusCode(http.StatusTooManyRequests)
+	response.SetHeader("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	return response
+}
@@ -0,0 +1,36 @@
+package miniserver
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	limiter := NewRateLimiter(RateLimit{2, time.Hour})
+
+	if allowed, _ := limiter.Allow("ip", "user"); !allowed {
+		t.Fatal("first request denied")
+	}
+	if allowed, _ := limiter.Allow("user"); !allowed {
+		t.Fatal("second request of user denied")
+	}
+
+	// The user is out of tokens, the ip mustn't pay for the denial
+	allowed, retryAfter := limiter.Allow("ip", "user")
+	if allowed {
+		t.Fatal("third request of user allowed")
+	}
+	if retryAfter <= 0 || retryAfter > time.Hour/2 {
+		t.Errorf("retry after %s", retryAfter)
+	}
+	if allowed, _ := limiter.Allow("ip"); !allowed {
+		t.Error("ip lost a token to a denied request")
+	}
+	if allowed, _ := limiter.Allow("ip"); allowed {
+		t.Error("ip got more than its tokens")
+	}
+
+	if allowed, _ := NewRateLimiter(RateLimit{}).Allow("ip"); !allowed {
+		t.Error("disabled limit denied a request")
+	}
+}
@@ -7,3 +7,20 @@ import (
 type Response interface {
 	write(writer http.ResponseWriter, client *Client)
 }
+
+// ObserveSize calls observe with the number of bytes
+// response wrote once it's done
+func ObserveSize(response Response, observe func(size int64)) Response {
+	return &sizeObservingResponse{response, observe}
+}
+
+type sizeObservingResponse struct {
+	Response
+	observe func(size int64)
+}
+
+func (response *sizeObservingResponse) write(writer http.ResponseWriter, client *Client) {
+	recorder := &responseRecorder{ResponseWriter: writer, status: http.StatusOK}
+	response.Response.write(recorder, client)
+	response.observe(recorder.size)
+}
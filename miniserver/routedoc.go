@@ -0,0 +1,59 @@
+package miniserver
+
+// QueryParam documents a query parameter of a route
+type QueryParam struct {
+	Name, Description string
+}
+
+// RouteInfo is what a route documents about itself, Request and
+// Response are example values whose types describe the json bodies
+type RouteInfo struct {
+	Method, Pattern string
+	Summary         string
+	Request         interface{}
+	Response        interface{}
+	// ContentType of successful responses which aren't json
+	ContentType string
+	Queries     []QueryParam
+}
+
+// Describe sets the summary shown in the api documentation
+func (route *Route) Describe(summary string) *Route {
+	route.info.Summary = summary
+	return route
+}
+
+// Accepts documents the json body the route expects
+func (route *Route) Accepts(body interface{}) *Route {
+	route.info.Request = body
+	return route
+}
+
+// Returns documents the json body of successful responses
+func (route *Route) Returns(body interface{}) *Route {
+	route.info.Response = body
+	return route
+}
+
+// Produces documents routes which answer with something else than json
+func (route *Route) Produces(contentType string) *Route {
+	route.info.ContentType = contentType
+	return route
+}
+
+// Query documents a query parameter the route reads
+func (route *Route) Query(name, description string) *Route {
+	route.info.Queries = append(route.info.Queries, QueryParam{name, description})
+	return route
+}
+
+// Routes returns the documentation of all registered routes
+func (router *Router) Routes() []RouteInfo {
+	infos := make([]RouteInfo, len(router.routes))
+	for i, route := range router.routes {
+		infos[i] = route.info
+		infos[i].Method = route.method
+		infos[i].Pattern = route.pattern
+	}
+	return infos
+}
@@ -0,0 +1,256 @@
+package miniserver
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/Grarak/GoYTFetcher/utils"
+)
+
+// Handler creates the response for a matched request
+type Handler func(client *Client) Response
+
+// Middleware wraps a handler, it can either pass the client
+// on to next or answer the request itself
+type Middleware func(next Handler) Handler
+
+// DefaultMaxBodySize is plenty for the json apis
+const DefaultMaxBodySize = 64 * 1024
+
+// Route is a registered pattern, its options can be adjusted after registration
+type Route struct {
+	method      string
+	pattern     string
+	segments    []string
+	handler     Handler
+	maxBodySize int64
+	info        RouteInfo
+}
+
+// Router dispatches clients to handlers registered by method and path pattern.
+// Patterns are slash separated, segments like {name} capture a single path
+// segment and a trailing {name...} captures the remaining path.
+type Router struct {
+	routes      []*Route
+	middlewares []Middleware
+	notFound    Handler
+	maxBodySize int64
+}
+
+// RouteGroup registers routes below a common prefix which share middlewares
+type RouteGroup struct {
+	router      *Router
+	prefix      string
+	middlewares []Middleware
+	maxBodySize int64
+}
+
+func NewRouter() *Router {
+	return &Router{maxBodySize: DefaultMaxBodySize}
+}
+
+// Use adds middlewares which run for every request, including unmatched ones
+func (router *Router) Use(middlewares ...Middleware) {
+	router.middlewares = append(router.middlewares, middlewares...)
+}
+
+// NotFound sets the handler for requests no route pattern matches
+func (router *Router) NotFound(handler Handler) {
+	router.notFound = handler
+}
+
+// SetMaxBodySize sets the body limit of routes which don't have their own
+func (router *Router) SetMaxBodySize(maxBodySize int64) {
+	router.maxBodySize = maxBodySize
+}
+
+func (router *Router) Handle(method, pattern string, handler Handler, middlewares ...Middleware) *Route {
+	route := &Route{
+		method:   method,
+		pattern:  joinPath("", pattern),
+		segments: splitPath(pattern),
+		handler:  chain(handler, middlewares),
+	}
+	router.routes = append(router.routes, route)
+	return route
+}
+
+func (router *Router) Group(prefix string, middlewares ...Middleware) *RouteGroup {
+	return &RouteGroup{router: router, prefix: joinPath("", prefix), middlewares: middlewares}
+}
+
+// ServeClient matches the client against the registered routes,
+// it can be passed to MiniServer.StartListening directly
+func (router *Router) ServeClient(client *Client) Response {
+	return chain(router.dispatch, router.middlewares)(client)
+}
+
+func (router *Router) dispatch(client *Client) Response {
+	segments := splitPath(client.Url)
+
+	type match struct {
+		route  *Route
+		params map[string]string
+	}
+	var matches []match
+	for _, route := range router.routes {
+		if params, ok := route.match(segments); ok {
+			matches = append(matches, match{route, params})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].route.staticSegments() > matches[j].route.staticSegments()
+	})
+
+	method := client.Method
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+
+	var allowed []string
+	for _, match := range matches {
+		if match.route.method == method {
+			client.Params = match.params
+			client.Pattern = match.route.pattern
+			if response := router.readBody(client, match.route); response != nil {
+				return response
+			}
+			return match.route.handler(client)
+		}
+		if !utils.StringArrayContains(allowed, match.route.method) {
+			allowed = append(allowed, match.route.method)
+		}
+	}
+
+	if len(allowed) > 0 {
+		response := client.ResponseBody("Method not allowed")
+		response.SetStatusCode(http.StatusMethodNotAllowed)
+		response.SetHeader("Allow", strings.Join(allowed, ", "))
+		return response
+	}
+
+	if router.notFound != nil {
+		return router.notFound(client)
+	}
+	return nil
+}
+
+func (router *Router) readBody(client *Client, route *Route) Response {
+	maxBodySize := route.maxBodySize
+	if maxBodySize <= 0 {
+		maxBodySize = router.maxBodySize
+	}
+
+	err := client.ReadBody(maxBodySize)
+	if err == nil {
+		return nil
+	}
+	if err == ErrBodyTooLarge {
+		response := client.ResponseBody("Request entity too large")
+		response.SetStatusCode(http.StatusRequestEntityTooLarge)
+		return response
+	}
+	response := client.ResponseBody("Bad request")
+	response.SetStatusCode(http.StatusBadRequest)
+	return response
+}
+
+// MaxBodySize overrides the body limit for this route
+func (route *Route) MaxBodySize(maxBodySize int64) *Route {
+	route.maxBodySize = maxBodySize
+	return route
+}
+
+// Use adds middlewares to all routes registered afterwards on this group
+func (group *RouteGroup) Use(middlewares ...Middleware) {
+	group.middlewares = append(group.middlewares, middlewares...)
+}
+
+// SetMaxBodySize sets the body limit of all routes registered afterwards on this group
+func (group *RouteGroup) SetMaxBodySize(maxBodySize int64) {
+	group.maxBodySize = maxBodySize
+}
+
+func (group *RouteGroup) Group(prefix string, middlewares ...Middleware) *RouteGroup {
+	return &RouteGroup{group.router, joinPath(group.prefix, prefix),
+		append(group.copyMiddlewares(), middlewares...), group.maxBodySize}
+}
+
+func (group *RouteGroup) Handle(method, pattern string, handler Handler, middlewares ...Middleware) *Route {
+	return group.router.Handle(method, joinPath(group.prefix, pattern), handler,
+		append(group.copyMiddlewares(), middlewares...)...).MaxBodySize(group.maxBodySize)
+}
+
+func (group *RouteGroup) Get(pattern string, handler Handler, middlewares ...Middleware) *Route {
+	return group.Handle(http.MethodGet, pattern, handler, middlewares...)
+}
+
+func (group *RouteGroup) Post(pattern string, handler Handler, middlewares ...Middleware) *Route {
+	return group.Handle(http.MethodPost, pattern, handler, middlewares...)
+}
+
+func (group *RouteGroup) Put(pattern string, handler Handler, middlewares ...Middleware) *Route {
+	return group.Handle(http.MethodPut, pattern, handler, middlewares...)
+}
+
+func (group *RouteGroup) Delete(pattern string, handler Handler, middlewares ...Middleware) *Route {
+	return group.Handle(http.MethodDelete, pattern, handler, middlewares...)
+}
+
+func (group *RouteGroup) copyMiddlewares() []Middleware {
+	middlewares := make([]Middleware, len(group.middlewares))
+	copy(middlewares, group.middlewares)
+	return middlewares
+}
+
+func (route *Route) match(segments []string) (map[string]string, bool) {
+	params := make(map[string]string)
+	for i, segment := range route.segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "...}") {
+			params[segment[1:len(segment)-4]] = strings.Join(segments[i:], "/")
+			return params, true
+		}
+		if i >= len(segments) {
+			return nil, false
+		}
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			params[segment[1:len(segment)-1]] = segments[i]
+		} else if segment != segments[i] {
+			return nil, false
+		}
+	}
+	return params, len(route.segments) == len(segments)
+}
+
+func (route *Route) staticSegments() int {
+	count := 0
+	for _, segment := range route.segments {
+		if !strings.HasPrefix(segment, "{") {
+			count++
+		}
+	}
+	return count
+}
+
+// chain wraps handler so the first middleware is the outermost one
+func chain(handler Handler, middlewares []Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+func splitPath(path string) []string {
+	segments := make([]string, 0)
+	for _, segment := range strings.Split(path, "/") {
+		if len(segment) > 0 {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+func joinPath(prefix, path string) string {
+	return strings.TrimSuffix(prefix, "/") + "/" + strings.Trim(path, "/")
+}
@@ -0,0 +1,72 @@
+package miniserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouterDispatch(t *testing.T) {
+	router := NewRouter()
+	respond := func(name string) Handler {
+		return func(client *Client) Response {
+			return client.ResponseBody(name + " " + client.Param("id") + client.Param("path"))
+		}
+	}
+	router.NotFound(func(client *Client) Response {
+		return client.ResponseNotFound()
+	})
+	group := router.Group("/api/items")
+	group.Get("", respond("list"))
+	group.Get("{id}", respond("get"))
+	group.Delete("{id}", respond("delete"))
+	// Registered after {id}, static segments still win
+	group.Get("new", respond("new"))
+	group.Put("{id}/tags", respond("tags"))
+	router.Group("/files").Get("{path...}", respond("files"))
+
+	tests := []struct {
+		name   string
+		method string
+		url    string
+		status int
+		body   string
+		allow  string
+	}{
+		{"list", http.MethodGet, "/api/items", http.StatusOK, "list ", ""},
+		{"trailing slash", http.MethodGet, "/api/items/", http.StatusOK, "list ", ""},
+		{"param", http.MethodGet, "/api/items/42", http.StatusOK, "get 42", ""},
+		{"static before param", http.MethodGet, "/api/items/new", http.StatusOK, "new ", ""},
+		{"head matches get", http.MethodHead, "/api/items/42", http.StatusOK, "get 42", ""},
+		{"method of param route", http.MethodDelete, "/api/items/new", http.StatusOK, "delete new", ""},
+		{"method not allowed", http.MethodPost, "/api/items/42", http.StatusMethodNotAllowed,
+			"Method not allowed", "GET, DELETE"},
+		{"allow of all matches", http.MethodPost, "/api/items/new", http.StatusMethodNotAllowed,
+			"Method not allowed", "GET, DELETE"},
+		{"nested", http.MethodPut, "/api/items/42/tags", http.StatusOK, "tags 42", ""},
+		{"nested wrong method", http.MethodGet, "/api/items/42/tags", http.StatusMethodNotAllowed,
+			"Method not allowed", "PUT"},
+		{"catch all", http.MethodGet, "/files/a/b/c.ogg", http.StatusOK, "files a/b/c.ogg", ""},
+		{"catch all empty", http.MethodGet, "/files", http.StatusOK, "files ", ""},
+		{"too many segments", http.MethodGet, "/api/items/42/43", http.StatusNotFound, "Not found", ""},
+		{"unknown", http.MethodGet, "/nope", http.StatusNotFound, "Not found", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(test.method, test.url, nil)
+			client := newClient(request, nil)
+			recorder := httptest.NewRecorder()
+			router.ServeClient(client).write(recorder, client)
+
+			if recorder.Code != test.status {
+				t.Errorf("status %d, want %d", recorder.Code, test.status)
+			}
+			if body := recorder.Body.String(); body != test.body {
+				t.Errorf("body %q, want %q", body, test.body)
+			}
+			if allow := recorder.Header().Get("Allow"); allow != test.allow {
+				t.Errorf("Allow %q, want %q", allow, test.allow)
+			}
+		})
+	}
+}
@@ -2,13 +2,14 @@ package miniserver
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
-	"strconv"
-	"strings"
+	"time"
 
 	"github.com/Grarak/GoYTFetcher/utils"
 )
@@ -18,6 +19,7 @@ type SimpleResponse struct {
 	headers                        http.Header
 	statusCode                     int
 	readHolder                     rangeReadHolder
+	precompressed                  map[string]string
 }
 
 type rangeReadHolder interface {
@@ -30,13 +32,13 @@ type rangeReadHolderBytes struct {
 	bytesReader *bytes.Reader
 }
 
-type rangeReadHolderFile struct {
-	file *os.File
+type etagReadHolderBytes struct {
+	*rangeReadHolderBytes
+	etag string
 }
 
-type rangeReader struct {
-	start, end, size int64
-	holder           rangeReadHolder
+type rangeReadHolderFile struct {
+	file *os.File
 }
 
 func newResponse() *SimpleResponse {
@@ -60,6 +62,9 @@ func (client *Client) ResponseFile(file string) *SimpleResponse {
 	reader, _ := os.Open(file)
 	response := client.ResponseReader(&rangeReadHolderFile{reader})
 	response.contentType = getContentTypeForFile(file)
+	if utils.FileExists(file + ".gz") {
+		response.precompressed = map[string]string{"gzip": file + ".gz"}
+	}
 	return response
 }
 
@@ -69,6 +74,12 @@ func (client *Client) ResponseReader(readHolder rangeReadHolder) *SimpleResponse
 	return response
 }
 
+func (client *Client) ResponseNotFound() *SimpleResponse {
+	response := client.ResponseBody("Not found")
+	response.SetStatusCode(http.StatusNotFound)
+	return response
+}
+
 func (client *Client) CreateJsonResponse(data interface{}) *SimpleResponse {
 	b, err := json.Marshal(data)
 	utils.Panic(err)
@@ -78,21 +89,22 @@ func (client *Client) CreateJsonResponse(data interface{}) *SimpleResponse {
 	return response
 }
 
+// StatusResponse is the body of CreateResponse
+type StatusResponse struct {
+	StatusCode int    `json:"statuscode"`
+	Message    string `json:"message"`
+	Path       string `json:"path"`
+}
+
+// CreateResponse answers with one of the utils.Status codes,
+// the HTTP status and message are derived from it
 func (client *Client) CreateResponse(statusCode int) *SimpleResponse {
-	type ResponseStruct struct {
-		StatusCode int    `json:"statuscode"`
-		Path       string `json:"path"`
-	}
-	b, err := json.Marshal(ResponseStruct{statusCode,
-		client.Url})
+	b, err := json.Marshal(StatusResponse{statusCode,
+		utils.StatusMessage(statusCode), client.Url})
 	utils.Panic(err)
 
 	response := client.ResponseBody(string(b))
-	if statusCode == utils.StatusNoError {
-		response.SetStatusCode(http.StatusOK)
-	} else {
-		response.SetStatusCode(http.StatusNotFound)
-	}
+	response.SetStatusCode(utils.StatusHttpCode(statusCode))
 	response.SetContentType(ContentJson)
 
 	return response
@@ -110,75 +122,105 @@ func (response *SimpleResponse) SetHeader(key, value string) {
 	response.headers.Set(key, value)
 }
 
+// EnableETag derives an ETag from an in-memory body,
+// so clients can revalidate it with If-None-Match
+func (response *SimpleResponse) EnableETag() {
+	if holder, ok := response.readHolder.(*rangeReadHolderBytes); ok {
+		body := make([]byte, holder.Size())
+		holder.ReadAt(body, 0)
+		hash := sha256.Sum256(body)
+		response.readHolder = &etagReadHolderBytes{holder,
+			"\"" + hex.EncodeToString(hash[:16]) + "\""}
+	}
+}
+
 func (response *SimpleResponse) write(writer http.ResponseWriter, client *Client) {
+	defer func() {
+		response.readHolder.Close()
+	}()
+
 	if !utils.StringIsEmpty(response.contentType) {
 		writer.Header().Set("Content-Type", response.contentType)
 	}
 	writer.Header().Set("Server", response.serverDescription)
 	for key := range response.headers {
-		writer.Header().Set(key, response.headers.Get(key))
-	}
-
-	readerSize := response.readHolder.Size()
-	contentLength := readerSize
-	start, end := int64(0), readerSize-1
-
-	ranges := client.Header.Get("Range")
-	statusCode := response.statusCode
-	if statusCode == http.StatusOK &&
-		strings.HasPrefix(ranges, "bytes=") &&
-		strings.Contains(ranges, "-") {
-		start, end = rangeParser(ranges)
-		if end < 0 {
-			end = readerSize - 1
+		if key == "Vary" {
+			// Middlewares like Cors might vary the response as well
+			writer.Header().Add(key, response.headers.Get(key))
+		} else {
+			writer.Header().Set(key, response.headers.Get(key))
 		}
+	}
 
-		if start >= readerSize-1 {
-			start = readerSize - 1
-		}
-		if end >= readerSize-1 {
-			end = readerSize - 1
+	encoding := ""
+	if isCompressible(response.contentType) {
+		writer.Header().Add("Vary", "Accept-Encoding")
+		if utils.StringIsEmpty(client.Header.Get("Range")) {
+			encoding = negotiateEncoding(client.Header.Get("Accept-Encoding"),
+				response.availableEncodings())
 		}
-		if end < start {
-			end = start
+	}
+	if file, ok := response.precompressed[encoding]; ok {
+		if reader, err := os.Open(file); err == nil {
+			response.readHolder.Close()
+			response.readHolder = &rangeReadHolderFile{reader}
+			writer.Header().Set("Content-Encoding", encoding)
+			encoding = ""
 		}
-		writer.Header().Set("Content-Range",
-			fmt.Sprintf("bytes %d-%d/%d", start, end, readerSize))
-		statusCode = http.StatusPartialContent
-
-		contentLength = end - start + 1
+	}
+	if encoder := findEncoder(encoding); encoder != nil &&
+		response.readHolder.Size() >= minCompressSize {
+		response.writeEncoded(writer, client, encoder)
+		return
 	}
 
-	reader := &rangeReader{
-		start, end, readerSize,
-		response.readHolder,
+	statusCode := response.statusCode
+	validator, hasValidator := response.readHolder.(Validator)
+	if hasValidator && statusCode == http.StatusOK {
+		writeValidators(writer, validator)
+		if isNotModified(client, validator) {
+			writer.WriteHeader(http.StatusNotModified)
+			return
+		}
 	}
-	defer reader.Close()
 
+	readerSize := response.readHolder.Size()
 	writer.Header().Set("Accept-Ranges", "bytes")
-	writer.Header().Set("Content-Length", fmt.Sprint(contentLength))
 
-	writer.WriteHeader(statusCode)
-	io.Copy(writer, reader)
-}
-
-func rangeParser(ranges string) (int64, int64) {
-	ranges = strings.Replace(ranges, "bytes=", "", 1)
+	rangeHeader := client.Header.Get("Range")
+	if statusCode != http.StatusOK || utils.StringIsEmpty(rangeHeader) ||
+		(hasValidator && !ifRangeMatches(client, validator)) {
+		writeRange(writer, response.readHolder, statusCode, 0, readerSize)
+		return
+	}
 
-	middleIndex := strings.Index(ranges, "-")
-	start, err := strconv.ParseInt(ranges[:middleIndex], 10, 64)
-	if err != nil {
-		return 0, 0
+	ranges, err := parseRanges(rangeHeader, readerSize)
+	if err == errNoOverlap {
+		writer.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", readerSize))
+		writer.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	if err != nil || sumRangesSize(ranges) > readerSize {
+		// Malformed or excessive ranges are ignored, serve the whole content
+		writeRange(writer, response.readHolder, statusCode, 0, readerSize)
+		return
 	}
 
-	end := int64(-1)
-	if middleIndex < len(ranges)-1 {
-		end, err = strconv.ParseInt(ranges[middleIndex+1:], 10, 64)
-		if err != nil {
-			return start, 0
-		}
+	if len(ranges) == 1 {
+		writer.Header().Set("Content-Range", ranges[0].contentRange(readerSize))
+		writeRange(writer, response.readHolder, http.StatusPartialContent,
+			ranges[0].start, ranges[0].length)
+		return
 	}
-	return start, end
+	writeMultipartRanges(writer, response.readHolder, response.contentType,
+		ranges, readerSize)
+}
+
+func writeRange(writer http.ResponseWriter, reader io.ReaderAt,
+	statusCode int, start, length int64) {
+	writer.Header().Set("Content-Length", fmt.Sprint(length))
+	writer.WriteHeader(statusCode)
+	io.Copy(writer, io.NewSectionReader(reader, start, length))
 }
 
 func (rangeReadHolderBytes *rangeReadHolderBytes) Size() int64 {
@@ -193,6 +235,14 @@ func (rangeReadHolderBytes *rangeReadHolderBytes) Close() error {
 	return nil
 }
 
+func (etagReadHolderBytes *etagReadHolderBytes) ETag() string {
+	return etagReadHolderBytes.etag
+}
+
+func (etagReadHolderBytes *etagReadHolderBytes) ModTime() time.Time {
+	return time.Time{}
+}
+
 func (rangeReadHolderFile *rangeReadHolderFile) Size() int64 {
 	info, err := rangeReadHolderFile.file.Stat()
 	if err != nil {
@@ -209,23 +259,18 @@ func (rangeReadHolderFile *rangeReadHolderFile) Close() error {
 	return rangeReadHolderFile.file.Close()
 }
 
-func (rangeReader *rangeReader) Read(b []byte) (n int, err error) {
-	if rangeReader.start >= rangeReader.size {
-		return 0, io.EOF
-	}
-
-	read, _ := rangeReader.holder.ReadAt(b, rangeReader.start)
-	newStart := rangeReader.start + int64(read)
-
-	if newStart > rangeReader.end {
-		read = int(rangeReader.end-rangeReader.start) + 1
-		rangeReader.start = rangeReader.size
+func (rangeReadHolderFile *rangeReadHolderFile) ModTime() time.Time {
+	info, err := rangeReadHolderFile.file.Stat()
+	if err != nil {
+		return time.Time{}
 	}
-
-	rangeReader.start = newStart
-	return read, nil
+	return info.ModTime()
 }
 
-func (rangeReader *rangeReader) Close() error {
-	return rangeReader.holder.Close()
+func (rangeReadHolderFile *rangeReadHolderFile) ETag() string {
+	info, err := rangeReadHolderFile.file.Stat()
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("\"%x-%x\"", info.ModTime().Unix(), info.Size())
 }
@@ -0,0 +1,125 @@
+package miniserver
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/Grarak/GoYTFetcher/utils"
+)
+
+// Matches fingerprinted file names like main.3f2a9c1b.js
+var hashedAssetRegex = regexp.MustCompile("[.\\-_][0-9a-fA-F]{8,}\\.[a-zA-Z0-9]+$")
+
+type StaticOptions struct {
+	Dir string
+	// SpaFallback is served for paths which don't exist and don't look
+	// like a file, so client side routing works. Empty disables it.
+	SpaFallback string
+	// DirectoryIndex serves index.html when a directory is requested
+	DirectoryIndex bool
+}
+
+type staticHandler struct {
+	root    string
+	options StaticOptions
+}
+
+// NewStaticHandler serves the files below options.Dir,
+// nothing outside of it can be reached
+func NewStaticHandler(options StaticOptions) (Handler, error) {
+	root, err := filepath.Abs(options.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return nil, err
+	}
+
+	handler := &staticHandler{root, options}
+	return handler.serve, nil
+}
+
+func (handler *staticHandler) serve(client *Client) Response {
+	if client.Method != http.MethodGet && client.Method != http.MethodHead {
+		response := client.ResponseBody("Method not allowed")
+		response.SetStatusCode(http.StatusMethodNotAllowed)
+		response.SetHeader("Allow", "GET, HEAD")
+		return response
+	}
+
+	cleanPath := path.Clean("/" + client.Url)
+	if file, ok := handler.resolve(cleanPath); ok {
+		return handler.responseFile(client, file)
+	}
+
+	if !utils.StringIsEmpty(handler.options.SpaFallback) &&
+		!strings.Contains(path.Base(cleanPath), ".") {
+		if file, ok := handler.resolve("/" + handler.options.SpaFallback); ok {
+			return handler.responseFile(client, file)
+		}
+	}
+
+	return client.ResponseNotFound()
+}
+
+// resolve maps the url path to a regular file below the root
+func (handler *staticHandler) resolve(cleanPath string) (string, bool) {
+	for _, segment := range strings.Split(cleanPath, "/") {
+		// Hidden files such as .git or .env are never served
+		if strings.HasPrefix(segment, ".") {
+			return "", false
+		}
+	}
+
+	file := filepath.Join(handler.root, filepath.FromSlash(cleanPath))
+	info, err := os.Stat(file)
+	if err != nil {
+		return "", false
+	}
+	if info.IsDir() {
+		if !handler.options.DirectoryIndex {
+			return "", false
+		}
+		file = filepath.Join(file, "index.html")
+		if info, err = os.Stat(file); err != nil || info.IsDir() {
+			return "", false
+		}
+	}
+
+	if !handler.isBelowRoot(file) {
+		return "", false
+	}
+	return file, info.Mode().IsRegular()
+}
+
+// isBelowRoot checks that symlinks don't lead outside of the root either
+func (handler *staticHandler) isBelowRoot(file string) bool {
+	realFile, err := filepath.EvalSymlinks(file)
+	return err == nil && strings.HasPrefix(realFile, handler.root+string(filepath.Separator))
+}
+
+func (handler *staticHandler) responseFile(client *Client, file string) Response {
+	response := client.ResponseFile(file)
+	response.SetHeader("X-Content-Type-Options", "nosniff")
+	for encoding, precompressed := range response.precompressed {
+		if info, err := os.Stat(precompressed); err != nil || !info.Mode().IsRegular() ||
+			!handler.isBelowRoot(precompressed) {
+			delete(response.precompressed, encoding)
+		}
+	}
+
+	name := filepath.Base(file)
+	switch {
+	case strings.HasSuffix(name, ".html"):
+		response.SetHeader("Cache-Control", "no-cache")
+	case hashedAssetRegex.MatchString(name):
+		response.SetHeader("Cache-Control", "public, max-age=31536000, immutable")
+	default:
+		response.SetHeader("Cache-Control", "public, max-age=3600")
+	}
+	return response
+}
@@ -0,0 +1,70 @@
+package miniserver
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStaticPrecompressedSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "root")
+	os.Mkdir(root, 0755)
+	files := map[string]string{
+		filepath.Join(dir, "secret.gz"):     "secret",
+		filepath.Join(root, "app.js"):       "app",
+		filepath.Join(root, "inside.js"):    "inside",
+		filepath.Join(root, "inside.js.gz"): "inside gzip",
+		filepath.Join(root, "outside.js"):   "outside",
+		filepath.Join(root, "directory.js"): "directory",
+	}
+	for file, content := range files {
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(dir, "secret.gz"), filepath.Join(root, "outside.js.gz")); err != nil {
+		t.Skip(err)
+	}
+	os.Mkdir(filepath.Join(root, "directory.js.gz"), 0755)
+
+	handler, err := NewStaticHandler(StaticOptions{Dir: root})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url      string
+		body     string
+		encoding string
+	}{
+		{"/app.js", "app", ""},
+		{"/inside.js", "inside gzip", "gzip"},
+		{"/outside.js", "outside", ""},
+		{"/directory.js", "directory", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, test.url, nil)
+			request.Header.Set("Accept-Encoding", "gzip")
+			client := newClient(request, nil)
+			recorder := httptest.NewRecorder()
+			handler(client).write(recorder, client)
+
+			if recorder.Body.String() != test.body {
+				t.Errorf("body %q, want %q", recorder.Body.String(), test.body)
+			}
+			if encoding := recorder.Header().Get("Content-Encoding"); encoding != test.encoding {
+				t.Errorf("Content-Encoding %q, want %q", encoding, test.encoding)
+			}
+		})
+	}
+}
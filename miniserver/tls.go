@@ -0,0 +1,99 @@
+package miniserver
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Grarak/GoYTFetcher/logger"
+)
+
+type certificateReloader struct {
+	certFile, keyFile string
+
+	certificate *tls.Certificate
+	modTime     time.Time
+	lock        sync.RWMutex
+}
+
+func newCertificateReloader(certFile, keyFile string) (*certificateReloader, error) {
+	reloader := &certificateReloader{certFile: certFile, keyFile: keyFile}
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+func (reloader *certificateReloader) filesModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{reloader.certFile, reloader.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (reloader *certificateReloader) load() error {
+	modTime, err := reloader.filesModTime()
+	if err != nil {
+		return err
+	}
+
+	certificate, err := tls.LoadX509KeyPair(reloader.certFile, reloader.keyFile)
+	if err != nil {
+		return err
+	}
+
+	reloader.lock.Lock()
+	defer reloader.lock.Unlock()
+	reloader.certificate = &certificate
+	reloader.modTime = modTime
+	return nil
+}
+
+func (reloader *certificateReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	modTime, err := reloader.filesModTime()
+
+	reloader.lock.RLock()
+	changed := err == nil && !modTime.Equal(reloader.modTime)
+	reloader.lock.RUnlock()
+
+	if changed {
+		if err := reloader.load(); err != nil {
+			// Keep serving the old certificate, the files
+			// might still be in the middle of being replaced
+			logger.E(fmt.Sprintf("Failed to reload certificate %s", err))
+		} else {
+			logger.I("Reloaded certificate " + reloader.certFile)
+		}
+	}
+
+	reloader.lock.RLock()
+	defer reloader.lock.RUnlock()
+	return reloader.certificate, nil
+}
+
+func newRedirectHandler(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		host := request.Host
+		if hostname, _, err := net.SplitHostPort(host); err == nil {
+			host = hostname
+		}
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		}
+
+		http.Redirect(writer, request, "https://"+host+request.URL.RequestURI(),
+			http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,228 @@
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/Grarak/GoYTFetcher/miniserver"
+	"github.com/Grarak/GoYTFetcher/utils"
+)
+
+const Version = "3.0.3"
+
+type Document struct {
+	OpenApi    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Paths      map[string]PathItem   `json:"paths"`
+	Components Components            `json:"components"`
+	Security   []SecurityRequirement `json:"security,omitempty"`
+
+	errorResponse *Response
+	schemaTypes   map[string]reflect.Type
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// PathItem holds the operations of a path by lower case method
+type PathItem map[string]*Operation
+
+type Operation struct {
+	Summary     string               `json:"summary,omitempty"`
+	OperationId string               `json:"operationId"`
+	Tags        []string             `json:"tags,omitempty"`
+	Parameters  []Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme,omitempty"`
+	In          string `json:"in,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// SecurityRequirement maps scheme names to their scopes
+type SecurityRequirement map[string][]string
+
+func New(title, version string) *Document {
+	return &Document{
+		OpenApi:     Version,
+		Info:        Info{Title: title, Version: version},
+		Paths:       make(map[string]PathItem),
+		Components:  Components{Schemas: make(map[string]*Schema)},
+		schemaTypes: make(map[string]reflect.Type),
+	}
+}
+
+// AddSecurityScheme makes scheme one of the ways to authenticate,
+// requests without any of them stay allowed by the document
+func (document *Document) AddSecurityScheme(name string, scheme SecurityScheme) {
+	if document.Components.SecuritySchemes == nil {
+		document.Components.SecuritySchemes = make(map[string]SecurityScheme)
+		// An empty requirement marks authentication as optional
+		document.Security = []SecurityRequirement{{}}
+	}
+	document.Components.SecuritySchemes[name] = scheme
+	document.Security = append([]SecurityRequirement{{name: {}}}, document.Security...)
+}
+
+// SetErrorResponse documents body as default response of every route added
+// afterwards, the returned schema of its struct can be refined further
+func (document *Document) SetErrorResponse(body interface{}, description string) *Schema {
+	schema := document.schemaOf(reflect.TypeOf(body))
+	document.errorResponse = &Response{
+		Description: description,
+		Content:     map[string]MediaType{miniserver.ContentJson: {schema}},
+	}
+	return document.Components.Schemas[strings.TrimPrefix(schema.Ref, schemaRef(""))]
+}
+
+// AddRoutes documents all routes whose pattern starts with prefix
+func (document *Document) AddRoutes(routes []miniserver.RouteInfo, prefix string) {
+	for _, route := range routes {
+		if strings.HasPrefix(route.Pattern, prefix) {
+			document.AddRoute(route)
+		}
+	}
+}
+
+func (document *Document) AddRoute(route miniserver.RouteInfo) {
+	path, parameters := pathParameters(route.Pattern)
+	for _, query := range route.Queries {
+		parameters = append(parameters, Parameter{
+			Name:        query.Name,
+			In:          "query",
+			Description: query.Description,
+			Schema:      &Schema{Type: "string"},
+		})
+	}
+
+	operation := &Operation{
+		Summary:     route.Summary,
+		OperationId: operationId(route.Method, route.Pattern),
+		Tags:        tags(route.Pattern),
+		Parameters:  parameters,
+		Responses:   make(map[string]*Response),
+	}
+	if route.Request != nil {
+		operation.RequestBody = &RequestBody{
+			Required: true,
+			Content: map[string]MediaType{
+				miniserver.ContentJson: {document.schemaOf(reflect.TypeOf(route.Request))},
+			},
+		}
+	}
+
+	success := &Response{Description: http.StatusText(http.StatusOK)}
+	switch {
+	case route.Response != nil:
+		success.Content = map[string]MediaType{
+			miniserver.ContentJson: {document.schemaOf(reflect.TypeOf(route.Response))},
+		}
+	case !utils.StringIsEmpty(route.ContentType):
+		schema := &Schema{Type: "string"}
+		if !strings.HasPrefix(route.ContentType, "text/") {
+			schema.Format = "binary"
+		}
+		success.Content = map[string]MediaType{route.ContentType: {schema}}
+	}
+	operation.Responses["2XX"] = success
+	if document.errorResponse != nil {
+		operation.Responses["default"] = document.errorResponse
+	}
+
+	item, ok := document.Paths[path]
+	if !ok {
+		item = make(PathItem)
+		document.Paths[path] = item
+	}
+	item[strings.ToLower(route.Method)] = operation
+}
+
+// pathParameters turns the route pattern into an openapi path,
+// the remaining path captured by {name...} becomes a single parameter
+func pathParameters(pattern string) (string, []Parameter) {
+	var parameters []Parameter
+	segments := strings.Split(pattern, "/")
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+			continue
+		}
+		name := strings.TrimSuffix(segment[1:len(segment)-1], "...")
+		segments[i] = "{" + name + "}"
+		parameters = append(parameters, Parameter{
+			Name:     name,
+			In:       "path",
+			Required: true,
+			Schema:   &Schema{Type: "string"},
+		})
+	}
+	return strings.Join(segments, "/"), parameters
+}
+
+func operationId(method, pattern string) string {
+	id := strings.ToLower(method)
+	for _, segment := range strings.Split(pattern, "/") {
+		segment = strings.Trim(segment, "{}.")
+		if !utils.StringIsEmpty(segment) {
+			id += "_" + segment
+		}
+	}
+	return id
+}
+
+// tags groups /api/<version>/<name> routes by version and name
+func tags(pattern string) []string {
+	segments := strings.Split(strings.Trim(pattern, "/"), "/")
+	if len(segments) >= 3 && segments[0] == "api" {
+		return []string{segments[1] + " " + segments[2]}
+	}
+	return []string{"server"}
+}
+
+// Codes documents the status codes of the error response
+func Codes(codes []int, describe func(code int) string) *Schema {
+	schema := &Schema{Type: "integer"}
+	descriptions := make([]string, len(codes))
+	for i, code := range codes {
+		schema.Enum = append(schema.Enum, code)
+		descriptions[i] = strconv.Itoa(code) + ": " + describe(code)
+	}
+	schema.Description = strings.Join(descriptions, "\n")
+	return schema
+}
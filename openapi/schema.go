@@ -0,0 +1,133 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+func schemaRef(name string) string {
+	return "#/components/schemas/" + name
+}
+
+// schemaOf describes how encoding/json marshals t, named
+// structs end up in the components and are referenced
+func (document *Document) schemaOf(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawMessageType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: document.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: document.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if len(t.Name()) == 0 {
+			return document.structSchema(t)
+		}
+		return &Schema{Ref: schemaRef(document.addStruct(t))}
+	}
+	// Interfaces can hold anything
+	return &Schema{}
+}
+
+// addStruct registers the schema of a named struct once and returns its name
+func (document *Document) addStruct(t reflect.Type) string {
+	name := exportedName(t.Name())
+	for existing, ok := document.schemaTypes[name]; ok; existing, ok = document.schemaTypes[name] {
+		if existing == t {
+			return name
+		}
+		// Same type name in different packages
+		name = exportedName(t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]) + name
+	}
+
+	document.schemaTypes[name] = t
+	// Registered before the fields, so recursive types terminate
+	schema := &Schema{}
+	document.Components.Schemas[name] = schema
+	*schema = *document.structSchema(t)
+	return name
+}
+
+func (document *Document) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")
+		name := tag[0]
+		if name == "-" && len(tag) == 1 {
+			continue
+		}
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		// Fields of embedded structs are promoted like encoding/json does
+		if field.Anonymous && len(name) == 0 && fieldType.Kind() == reflect.Struct {
+			for property, fieldSchema := range document.structSchema(fieldType).Properties {
+				if _, ok := schema.Properties[property]; !ok {
+					schema.Properties[property] = fieldSchema
+				}
+			}
+			continue
+		}
+		if len(field.PkgPath) > 0 {
+			continue
+		}
+
+		if len(name) == 0 {
+			name = field.Name
+		}
+		schema.Properties[name] = document.schemaOf(field.Type)
+	}
+	return schema
+}
+
+func exportedName(name string) string {
+	runes := []rune(name)
+	if len(runes) == 0 {
+		return name
+	}
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
@@ -4,3 +4,8 @@ type PlaylistName struct {
 	ApiKey string `json:"apikey"`
 	Name   string `json:"name"`
 }
+
+type PlaylistUpdate struct {
+	Public *bool    `json:"public,omitempty"`
+	Items  []string `json:"items,omitempty"`
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math/rand"
 	"net/http"
@@ -15,8 +16,30 @@ import (
 var port int
 
 func main() {
+	var name, password string
 	flag.IntVar(&port, "p", 6713, "Which port to use")
+	flag.StringVar(&name, "user", "", "Log in as this user and try the v2 api")
+	flag.StringVar(&password, "password", "", "Password of -user")
 	flag.Parse()
+
+	if name == "" {
+		return
+	}
+	apiKey, err := loginUser(name, password)
+	Panic(err)
+	testV2(apiKey)
+}
+
+// testV2 runs through the v2 api with the apikey as bearer token
+func testV2(apiKey string) {
+	Panic(searchYoutubeV2(apiKey, "never gonna give you up"))
+	Panic(createPlaylistV2(apiKey, "testing"))
+	Panic(listUsersV2(apiKey))
+
+	// A key of its own works like the one of the login
+	testingKey, err := createApiKey(apiKey, "testing")
+	Panic(err)
+	Panic(searchYoutubeV2(testingKey, "never gonna give you up"))
 }
 
 func createUsers() {
@@ -57,7 +80,8 @@ func signupUser(name, password string) error {
 	return nil
 }
 
-func loginUser(name, password string) error {
+// loginUser returns the apikey of the login, it replaces the one of the previous login
+func loginUser(name, password string) (string, error) {
 	user := User{
 		Name:     name,
 		Password: Encode(password),
@@ -68,17 +92,21 @@ func loginUser(name, password string) error {
 		"application/json",
 		bytes.NewBuffer(user.ToJson()))
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	b, err := ioutil.ReadAll(res.Body)
 	defer res.Body.Close()
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	fmt.Println("login: " + string(b))
-	return nil
+	var loggedIn User
+	if err := json.Unmarshal(b, &loggedIn); err != nil {
+		return "", err
+	}
+	return loggedIn.ApiKey, nil
 }
 
 func listUsers(apiKey string) error {
@@ -217,6 +245,108 @@ func fetchYoutube(apiKey, id string) error {
 	return nil
 }
 
+// requestV2 sends a v2 request, which authenticates with a bearer token
+func requestV2(method, path, apiKey string, body interface{}) ([]byte, error) {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewBuffer(b)
+	}
+
+	req, err := http.NewRequest(method, getUrl("v2", path), reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("%s %s: %d %s", method, path, res.StatusCode, string(b))
+	}
+	return b, nil
+}
+
+// listUsersV2 walks through all pages of the users
+func listUsersV2(apiKey string) error {
+	cursor := ""
+	for {
+		queries := url.Values{}
+		queries.Set("limit", "50")
+		if cursor != "" {
+			queries.Set("cursor", cursor)
+		}
+
+		b, err := requestV2(http.MethodGet, "users?"+queries.Encode(), apiKey, nil)
+		if err != nil {
+			return err
+		}
+
+		var page Page
+		if err := json.Unmarshal(b, &page); err != nil {
+			return err
+		}
+		fmt.Println(fmt.Sprintf("list users v2: %d of %d", len(page.Items), page.Total))
+		if page.Next == "" {
+			return nil
+		}
+		cursor = page.Next
+	}
+}
+
+func createPlaylistV2(apiKey, name string) error {
+	public := false
+	b, err := requestV2(http.MethodPut, "playlists/"+url.PathEscape(name), apiKey,
+		PlaylistUpdate{Public: &public})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("create playlist v2: " + string(b))
+	return nil
+}
+
+func searchYoutubeV2(apiKey, searchQuery string) error {
+	queries := url.Values{}
+	queries.Set("q", searchQuery)
+	b, err := requestV2(http.MethodGet, "search?"+queries.Encode(), apiKey, nil)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("search youtube v2: " + string(b))
+	return nil
+}
+
+// createApiKey returns a new key of the user named name
+func createApiKey(apiKey, name string) (string, error) {
+	b, err := requestV2(http.MethodPost, "keys", apiKey, ApiKey{Name: name})
+	if err != nil {
+		return "", err
+	}
+
+	var created ApiKey
+	if err := json.Unmarshal(b, &created); err != nil {
+		return "", err
+	}
+	fmt.Println("create apikey: " + created.Id)
+	return created.ApiKey, nil
+}
+
 func testDatastructures() {
 	ranking := &rankingTree{}
 
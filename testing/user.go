@@ -14,3 +14,15 @@ func (user User) ToJson() []byte {
 	utils.Panic(err)
 	return b
 }
+
+type Page struct {
+	Items []json.RawMessage `json:"items"`
+	Next  string            `json:"next"`
+	Total int               `json:"total"`
+}
+
+type ApiKey struct {
+	Id     string `json:"id,omitempty"`
+	Name   string `json:"name"`
+	ApiKey string `json:"apikey,omitempty"`
+}
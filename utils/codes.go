@@ -1,5 +1,12 @@
 package utils
 
+import (
+	"net/http"
+	"sort"
+)
+
+// Status codes sent to clients, never renumber them,
+// the Android client relies on their values
 const (
 	StatusNoError                 = 0
 	StatusInvalid                 = 1
@@ -19,4 +26,74 @@ const (
 	StatusYoutubeGetChartsFailure = 15
 	StatusPlaylistIdAlreadyExists = 16
 	StatusAddHistoryFailed        = 17
+	StatusUnauthorized            = 18
+	StatusNotVerified             = 19
+	StatusForbidden               = 20
+	StatusNotFound                = 21
+	StatusInternalError           = 22
+	StatusPlaylistAlreadyExists   = 23
+	StatusSignupClosed            = 24
+	StatusSongDownloading         = 25
+	StatusShuttingDown            = 26
 )
+
+type statusDescription struct {
+	httpStatus int
+	message    string
+}
+
+var statusDescriptions = map[int]statusDescription{
+	StatusNoError:                 {http.StatusOK, "OK"},
+	StatusInvalid:                 {http.StatusBadRequest, "Invalid request"},
+	StatusNameShort:               {http.StatusBadRequest, "Name is too short"},
+	StatusPasswordShort:           {http.StatusBadRequest, "Password is too short"},
+	StatusPasswordInvalid:         {http.StatusBadRequest, "Password is not base64 encoded"},
+	StatusNameInvalid:             {http.StatusBadRequest, "Name may only contain letters, digits and underscores"},
+	StatusAddUserFailed:           {http.StatusInternalServerError, "Failed to create the user"},
+	StatusUserAlreadyExists:       {http.StatusConflict, "User already exists"},
+	StatusInvalidPassword:         {http.StatusUnauthorized, "Wrong name or password"},
+	StatusPasswordLong:            {http.StatusBadRequest, "Password is too long"},
+	StatusNameLong:                {http.StatusBadRequest, "Name is too long"},
+	StatusYoutubeFetchFailure:     {http.StatusBadGateway, "Failed to fetch the video from youtube"},
+	StatusYoutubeSearchFailure:    {http.StatusBadGateway, "Failed to search youtube"},
+	StatusYoutubeGetFailure:       {http.StatusNotFound, "Song doesn't exist, fetch it first"},
+	StatusYoutubeGetInfoFailure:   {http.StatusBadGateway, "Failed to get the video info from youtube"},
+	StatusYoutubeGetChartsFailure: {http.StatusBadGateway, "Failed to get the charts from youtube"},
+	StatusPlaylistIdAlreadyExists: {http.StatusConflict, "Video is already in the playlist"},
+	StatusAddHistoryFailed:        {http.StatusInternalServerError, "Failed to add the video to the history"},
+	StatusUnauthorized:            {http.StatusUnauthorized, "Missing or unknown apikey"},
+	StatusNotVerified:             {http.StatusForbidden, "User is not verified yet"},
+	StatusForbidden:               {http.StatusForbidden, "Only admins are allowed to do this"},
+	StatusNotFound:                {http.StatusNotFound, "Not found"},
+	StatusInternalError:           {http.StatusInternalServerError, "Internal server error"},
+	StatusPlaylistAlreadyExists:   {http.StatusConflict, "Playlist already exists"},
+	StatusSignupClosed:            {http.StatusForbidden, "Signups are closed"},
+	StatusSongDownloading:         {http.StatusConflict, "Song is being downloaded"},
+	StatusShuttingDown:            {http.StatusServiceUnavailable, "Server is shutting down"},
+}
+
+// StatusHttpCode maps a status code to the matching HTTP status
+func StatusHttpCode(code int) int {
+	if description, ok := statusDescriptions[code]; ok {
+		return description.httpStatus
+	}
+	return http.StatusInternalServerError
+}
+
+// StatusMessage describes a status code for humans
+func StatusMessage(code int) string {
+	if description, ok := statusDescriptions[code]; ok {
+		return description.message
+	}
+	return "Unknown error"
+}
+
+// StatusCodes lists all known status codes in ascending order
+func StatusCodes() []int {
+	codes := make([]int, 0, len(statusDescriptions))
+	for code := range statusDescriptions {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	return codes
+}
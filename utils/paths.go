@@ -5,6 +5,8 @@ const (
 	LOG_PREFIX    = "log"
 	LOG_EXTENSION = ".txt"
 
+	ACCESS_LOG_PREFIX = "access"
+
 	FILES       = "files"
 	DATABASE    = FILES + "/sqldata"
 	DATADB      = DATABASE + "/data.db"
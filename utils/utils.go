@@ -1,7 +1,11 @@
 package utils
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net"
@@ -25,12 +29,17 @@ func StringIsEmpty(data string) bool {
 }
 
 func StringArrayContains(array []string, item string) bool {
-	for _, value := range array {
+	return StringArrayIndex(array, item) >= 0
+}
+
+// StringArrayIndex returns the first index of item, -1 if it's missing
+func StringArrayIndex(array []string, item string) int {
+	for i, value := range array {
 		if value == item {
-			return true
+			return i
 		}
 	}
-	return false
+	return -1
 }
 
 func FormatMinutesSeconds(minutes, seconds int) string {
@@ -77,6 +86,38 @@ func ExecuteCmd(name string, arg ...string) (string, error) {
 	return string(buf), nil
 }
 
+// ExecuteCmdContext runs the command until it exits, onLine (if not nil)
+// gets every line of the output as soon as it's printed.
+// The process gets killed once ctx is done
+func ExecuteCmdContext(ctx context.Context, onLine func(line string),
+	name string, arg ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, arg...)
+	reader, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+
+	output := new(bytes.Buffer)
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		output.WriteString(scanner.Text() + "\n")
+		if onLine != nil {
+			onLine(scanner.Text())
+		}
+	}
+	// Drain whatever didn't fit into the scanner, so the process can exit
+	io.Copy(output, reader)
+
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+	return output.String(), err
+}
+
 func FileExists(file string) bool {
 	_, err := os.Stat(file)
 	return err == nil
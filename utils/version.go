@@ -0,0 +1,8 @@
+package utils
+
+// Version and Commit are set when building, e.g.
+// go build -ldflags "-X github.com/Grarak/GoYTFetcher/utils.Version=1.0.0"
+var (
+	Version = "dev"
+	Commit  = "unknown"
+)
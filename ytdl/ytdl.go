@@ -3,6 +3,7 @@ package ytdl
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
@@ -32,6 +33,9 @@ var jsonRegex = regexp.MustCompile("ytplayer.config = (.*?);ytplayer.load")
 var sigRegex = regexp.MustCompile("\\/s\\/([a-fA-F0-9\\.]+)")
 var sigSubRegex = regexp.MustCompile("([a-fA-F0-9\\.]+)")
 
+// Matches the progress lines of youtube-dl like "[download]  42.3% of 3.21MiB"
+var downloadProgressRegex = regexp.MustCompile("^\\[download\\]\\s+([0-9.]+)%")
+
 // VideoInfo contains the info a youtube video
 type VideoInfo struct {
 	ID       string `json:"id"`
@@ -495,11 +499,24 @@ func readXmlUntilComplete(start string, reader *bufio.Reader, position int, tags
 	return start, fmt.Errorf("couldn't parse xml")
 }
 
-func (info *VideoInfo) Download(path, youtubeDL string) (string, error) {
+// Download extracts the audio with youtube-dl, progress (if not nil)
+// receives the download percentage while it's running
+func (info *VideoInfo) Download(ctx context.Context, path, youtubeDL string,
+	progress func(percent float64)) (string, error) {
 	destination := path + "/" + info.ID + ".%(ext)s"
 
-	output, err := utils.ExecuteCmd(youtubeDL, "--extract-audio", "--audio-format",
-		"vorbis", "--output", destination, "--", info.ID)
+	onLine := func(line string) {
+		if progress == nil {
+			return
+		}
+		if matches := downloadProgressRegex.FindStringSubmatch(line); len(matches) > 1 {
+			if percent, err := strconv.ParseFloat(matches[1], 64); err == nil {
+				progress(percent)
+			}
+		}
+	}
+	output, err := utils.ExecuteCmdContext(ctx, onLine, youtubeDL, "--newline",
+		"--extract-audio", "--audio-format", "vorbis", "--output", destination, "--", info.ID)
 	if err != nil {
 		return "", err
 	}